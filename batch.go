@@ -0,0 +1,218 @@
+// 複数の SMTL ファイルの一括処理
+// ディレクトリの中の SMTL ファイルをそれぞれ独立したコンテクストで並列に解決し、
+// 結果の一覧を表示する。
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	batchCmdFmt = "Usage: %s [options] batch dir... [-j n] [-o outdir] [-timeout duration]\n"
+)
+
+// batchResult は一つの SMTL ファイルの処理結果を保持する構造体。
+type batchResult struct {
+	path    string
+	code    int
+	err     error
+	out     bytes.Buffer  // 解決結果の出力
+	stats   runStats      // 統計情報
+	elapsed time.Duration // 所要時間
+}
+
+// runBatch は batch コマンドを実行する関数。
+func runBatch(opts *options, args []string) int {
+	// batch コマンドのオプションの処理
+	fset := flag.NewFlagSet("batch", flag.ContinueOnError)
+	jobs := fset.Int("j", runtime.NumCPU(), "number of files solved in parallel")
+	outDir := fset.String("o", "", "write results of each file into `outdir`")
+	fset.DurationVar(&opts.timeout, "timeout", opts.timeout, "timeout of solver for each file")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, batchCmdFmt, os.Args[0])
+		fset.PrintDefaults()
+	}
+	dirs, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(dirs) == 0 || *jobs < 1 {
+		fset.Usage()
+		return exitUsage
+	}
+
+	// SMTL ファイルを探す。
+	// main 関数を持たないファイルはインポートされるパッケージのファイルとして除く。
+	// 結果の書き出し先は、指定されたディレクトリからの相対パスとする。
+	var paths, outPaths []string
+	written := map[string]string{}
+	for _, dir := range dirs {
+		var found []string
+		found, err = findSmtlFiles([]string{dir})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		for _, path := range found {
+			if isPackageFile(path) {
+				continue
+			}
+			paths = append(paths, path)
+			if *outDir == "" {
+				continue
+			}
+			var outPath string
+			outPath, err = batchOutPath(*outDir, dir, path)
+			if err == nil && written[outPath] != "" {
+				err = fmt.Errorf("results of %s and %s are both written to %s", written[outPath], path, outPath)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			written[outPath] = path
+			outPaths = append(outPaths, outPath)
+		}
+	}
+
+	// 各ファイルを並列に解決する
+	results := make([]*batchResult, len(paths))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				results[j] = solveBatchFile(paths[j], opts)
+			}
+		}()
+	}
+	for j := range paths {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	// 各ファイルの結果を出力する
+	code := exitSat
+	for i, r := range results {
+		if r.err != nil {
+			fmt.Fprintln(&r.out, r.err)
+			code = exitError
+		}
+		if *outDir == "" {
+			fmt.Printf("=== %s\n", r.path)
+			os.Stdout.Write(r.out.Bytes())
+			continue
+		}
+		outPath := outPaths[i]
+		err = os.MkdirAll(filepath.Dir(outPath), 0755)
+		if err == nil {
+			err = os.WriteFile(outPath, r.out.Bytes(), 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	// 結果の一覧を表示する
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tRESULT\tTIME")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", r.path, r.stats.Result, r.elapsed.Round(time.Millisecond))
+	}
+	tw.Flush()
+
+	return code
+}
+
+// solveBatchFile は一つの SMTL ファイルを解決する関数。
+// コンテクストはファイルごとに作成されるため、複数のゴルーチンから同時に呼び出せる。
+func solveBatchFile(path string, opts *options) (r *batchResult) {
+	r = &batchResult{path: path}
+	r.stats = runStats{File: path, Result: "error"}
+	start := time.Now()
+	r.code, r.err = solveFiles(&r.out, []string{path}, opts, &r.stats)
+	r.elapsed = time.Since(start)
+	return
+}
+
+// batchOutPath は root で見つけた SMTL ファイル path の結果を書き出すパスを返す関数。
+// outDir の下の、root からの相対パスに ".out" を付けたものとなる。
+// root がファイルの場合はそのファイル名とする。outDir の外となるパスはエラーとする。
+func batchOutPath(outDir, root, path string) (outPath string, err error) {
+	rel := filepath.Base(path)
+	if path != root {
+		if rel, err = filepath.Rel(root, path); err != nil {
+			return
+		}
+	}
+	rel = filepath.Clean(rel)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("result of %s is outside of %s", path, outDir)
+		return
+	}
+	outPath = filepath.Join(outDir, rel+".out")
+	return
+}
+
+// findSmtlFiles はディレクトリの中の SMTL ファイル (*.smtl) を探す関数。
+// ディレクトリではなくファイルが指定された場合はそのファイルを含める。
+func findSmtlFiles(dirs []string) (paths []string, err error) {
+	for _, dir := range dirs {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && (path == dir || filepath.Ext(path) == ".smtl") {
+				paths = append(paths, path)
+			}
+			return err
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// isPackageFile は SMTL ファイルが main 関数を持たない、インポートされるための
+// パッケージのファイルかどうかを判定する関数。
+// パースできないファイルは誤りを報告するために問題のファイルとして扱う。
+func isPackageFile(path string) bool {
+	fileNode, err := parseSmtlSource(token.NewFileSet(), path, 0)
+	if err != nil {
+		return false
+	}
+	for _, decl := range fileNode.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "main" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseInterspersed はオプションと引数が混在したコマンドラインを処理する関数。
+// オプション以外の引数のリストを返す。
+func parseInterspersed(fset *flag.FlagSet, args []string) (rest []string, err error) {
+	for {
+		err = fset.Parse(args)
+		if err != nil || fset.NArg() == 0 {
+			return
+		}
+		rest = append(rest, fset.Arg(0))
+		args = fset.Args()[1:]
+	}
+}
@@ -0,0 +1,323 @@
+// 式の型のチェック
+// z3 の AST を構築する前に式の型 (int もしくは bool) を調べ、
+// 型の合わない演算を誤りとして検出する。
+// go-z3 は型の合わない AST の構築を Z3 のエラーハンドラーに委ねており、
+// その場合はプログラムが異常終了してしまうため、事前にチェックする。
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// 型の名前
+const (
+	sortInt  = "int"
+	sortBool = "bool"
+)
+
+// exprSort は式の型を返す関数。型の合わない演算を含む場合はエラーとなる。
+func exprSort(varTab map[string]*smtlVar, expr ast.Expr) (sort string, err error) {
+	switch expr.(type) {
+	case *ast.Ident:
+		ident := expr.(*ast.Ident)
+		switch ident.Name {
+		case "true", "false":
+			sort = sortBool
+		default:
+			if v := varTab[ident.Name]; v != nil && v.dims != nil {
+				err = fmt.Errorf("array %s must be indexed", ident.Name)
+			} else if v != nil {
+				sort = v.sort
+			} else {
+				err = fmt.Errorf("%s is unknown variable", ident.Name)
+			}
+		}
+
+	case *ast.BasicLit:
+		if expr.(*ast.BasicLit).Kind == token.INT {
+			sort = sortInt
+		} else {
+			err = fmt.Errorf("not supported Kind of BasicLit")
+		}
+
+	case *ast.ParenExpr:
+		sort, err = exprSort(varTab, expr.(*ast.ParenExpr).X)
+
+	case *ast.BinaryExpr:
+		sort, err = binaryExprSort(varTab, expr.(*ast.BinaryExpr))
+
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		if ue.Op != token.NOT {
+			err = fmt.Errorf("not supported bop")
+			break
+		}
+		sort, err = exprSort(varTab, ue.X)
+		if err == nil && sort != sortBool {
+			err = fmt.Errorf("%s: operand of ! must be bool", types.ExprString(expr))
+		}
+
+	case *ast.CallExpr:
+		sort, err = callExprSort(varTab, expr.(*ast.CallExpr))
+
+	case *ast.IndexExpr:
+		var name string
+		name, err = indexElemName(varTab, expr.(*ast.IndexExpr))
+		if err == nil {
+			sort = varTab[name].sort
+		}
+
+	default:
+		err = fmt.Errorf("not supported Expr")
+	}
+	return
+}
+
+// binaryExprSort は二項演算式の型を返す関数。
+func binaryExprSort(varTab map[string]*smtlVar, be *ast.BinaryExpr) (sort string, err error) {
+	var x, y string
+	x, err = exprSort(varTab, be.X)
+	if err != nil {
+		return
+	}
+	y, err = exprSort(varTab, be.Y)
+	if err != nil {
+		return
+	}
+
+	// 演算子に応じた被演算子の型と結果の型
+	var operand string
+	switch be.Op {
+	case token.ADD, token.SUB, token.MUL: // + - *
+		operand, sort = sortInt, sortInt
+	case token.LSS, token.GTR, token.LEQ, token.GEQ: // < > <= >=
+		operand, sort = sortInt, sortBool
+	case token.LAND, token.LOR: // && ||
+		operand, sort = sortBool, sortBool
+	case token.EQL, token.NEQ: // == !=
+		operand, sort = x, sortBool
+	default:
+		err = fmt.Errorf("not supported bop")
+		return
+	}
+	if x != operand || y != operand {
+		err = fmt.Errorf("%s: mismatched types %s %s %s", types.ExprString(be), x, be.Op, y)
+	}
+	return
+}
+
+// callExprSort は関数呼び出しの型を返す関数。
+func callExprSort(varTab map[string]*smtlVar, ce *ast.CallExpr) (sort string, err error) {
+	// 引数の型
+	var args []string
+	for _, arg := range ce.Args {
+		var s string
+		s, err = exprSort(varTab, arg)
+		if err != nil {
+			return
+		}
+		args = append(args, s)
+	}
+
+	// 各引数の型が want であることを確認する関数
+	expect := func(name string, want ...string) {
+		for i, s := range args {
+			w := want[len(want)-1]
+			if i < len(want) {
+				w = want[i]
+			}
+			if s != w {
+				err = fmt.Errorf("argument %d of %s must be %s", i+1, name, w)
+				return
+			}
+		}
+	}
+
+	switch ce.Fun.(type) {
+	case *ast.Ident:
+		name := ce.Fun.(*ast.Ident).Name
+		switch name {
+		case "distinct":
+			sort = sortBool
+			if len(args) > 0 {
+				expect(name, args[0])
+			}
+		case "sum", "min", "max", "abs":
+			sort = sortInt
+			expect(name, sortInt)
+		case "count":
+			sort = sortInt
+			expect(name, sortBool)
+		case "atMost", "atLeast", "exactly":
+			sort = sortBool
+			expect(name, sortInt, sortBool)
+		case "pbLe", "pbGe", "pbEq":
+			sort = sortBool
+			if len(args) > 0 && args[0] != sortInt {
+				err = fmt.Errorf("argument 1 of %s must be %s", name, sortInt)
+			}
+			for i := 1; i < len(args); i += 2 {
+				if args[i] != sortInt || (i+1 < len(args) && args[i+1] != sortBool) {
+					err = fmt.Errorf("%s must have k and pairs of weight and bool", name)
+				}
+			}
+		default:
+			err = fmt.Errorf("not supported Name of Indent")
+		}
+
+	case *ast.SelectorExpr:
+		se := ce.Fun.(*ast.SelectorExpr)
+		switch se.Sel.Name {
+		case "implies", "iff":
+			sort = sortBool
+			var x string
+			x, err = exprSort(varTab, se.X)
+			if err == nil && x != sortBool {
+				err = fmt.Errorf("receiver of %s must be bool", se.Sel.Name)
+			}
+			if err == nil {
+				expect(se.Sel.Name, sortBool)
+			}
+		default:
+			err = fmt.Errorf("not supported Sel.Name of SelectorExpr")
+		}
+
+	default:
+		err = fmt.Errorf("not supported Fun of CallExpr")
+	}
+	return
+}
+
+// checkConstExpr は式が定数の値として使用できるか (変数を含まないか) を調べる関数。
+func checkConstExpr(varTab map[string]*smtlVar, expr ast.Expr) (err error) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n.(type) {
+		case *ast.CallExpr:
+			// 関数名ではなく引数を調べる
+			for _, arg := range n.(*ast.CallExpr).Args {
+				if err = checkConstExpr(varTab, arg); err != nil {
+					break
+				}
+			}
+			if se, ok := n.(*ast.CallExpr).Fun.(*ast.SelectorExpr); ok && err == nil {
+				err = checkConstExpr(varTab, se.X)
+			}
+			return false
+		case *ast.Ident:
+			ident := n.(*ast.Ident)
+			if v := varTab[ident.Name]; v != nil && !v.isConst {
+				err = fmt.Errorf("%s is not constant", types.ExprString(expr))
+			}
+		}
+		return true
+	})
+	return
+}
+
+// indexElemName は c[i][j] のような配列の要素の式から、要素の変数の名前を返す関数。
+// 添字は定数式でなければならず、全ての次元を指定しなければならない。
+func indexElemName(varTab map[string]*smtlVar, ie *ast.IndexExpr) (name string, err error) {
+	// 配列の名前と添字の式
+	var indices []ast.Expr
+	var expr ast.Expr = ie
+	for {
+		x, ok := expr.(*ast.IndexExpr)
+		if !ok {
+			break
+		}
+		indices = append([]ast.Expr{x.Index}, indices...)
+		expr = x.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		err = fmt.Errorf("not supported X of IndexExpr")
+		return
+	}
+	v := varTab[ident.Name]
+	switch {
+	case v == nil:
+		err = fmt.Errorf("%s is unknown variable", ident.Name)
+		return
+	case v.dims == nil:
+		err = fmt.Errorf("%s: %s is not array", types.ExprString(ie), ident.Name)
+		return
+	case len(indices) != len(v.dims):
+		err = fmt.Errorf("%s: array %s has %d dimensions", types.ExprString(ie), ident.Name, len(v.dims))
+		return
+	}
+
+	// 添字の範囲のチェック
+	var b strings.Builder
+	b.WriteString(ident.Name)
+	for i, index := range indices {
+		var n int
+		n, err = constInt(varTab, index)
+		if err != nil {
+			return
+		}
+		if n < 0 || n >= v.dims[i] {
+			err = fmt.Errorf("%s: index %d out of range [0:%d]", types.ExprString(ie), n, v.dims[i])
+			return
+		}
+		fmt.Fprintf(&b, "[%d]", n)
+	}
+	name = b.String()
+	return
+}
+
+// constInt は int の定数式の値を返す関数。
+// 配列の長さと添字に使用する。
+func constInt(varTab map[string]*smtlVar, expr ast.Expr) (n int, err error) {
+	val := constValue(varTab, expr)
+	if val == nil || val.Kind() != constant.Int {
+		err = fmt.Errorf("%s is not constant int", types.ExprString(expr))
+		return
+	}
+	i, ok := constant.Int64Val(val)
+	if !ok || int64(int(i)) != i {
+		err = fmt.Errorf("%s overflows int", types.ExprString(expr))
+		return
+	}
+	n = int(i)
+	return
+}
+
+// constValue は整数リテラル、定数およびそれらの加減乗算からなる int の式の値を返す関数。
+// 値を求められない場合は nil を返す。
+func constValue(varTab map[string]*smtlVar, expr ast.Expr) (val constant.Value) {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		if bl.Kind == token.INT {
+			val = constant.MakeFromLiteral(bl.Value, token.INT, 0)
+		}
+
+	case *ast.Ident:
+		if v := varTab[expr.(*ast.Ident).Name]; v != nil && v.isConst {
+			val = v.val
+		}
+
+	case *ast.ParenExpr:
+		val = constValue(varTab, expr.(*ast.ParenExpr).X)
+
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		x, y := constValue(varTab, be.X), constValue(varTab, be.Y)
+		if x != nil && y != nil && (be.Op == token.ADD || be.Op == token.SUB || be.Op == token.MUL) {
+			val = constant.BinaryOp(x, be.Op, y)
+		}
+	}
+	if val != nil && val.Kind() != constant.Int {
+		val = nil
+	}
+	return
+}
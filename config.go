@@ -0,0 +1,190 @@
+// Z3 の設定パラメータ
+// コンテクストのパラメータ (timeout、model_validate など) は Z3_set_param_value で、
+// それ以外のソルバーのパラメータ (smt.random_seed など) は z3 パッケージの
+// Z3_solver_set_params で設定する。ソルバーのロジック (-logic) と
+// タクティク (//smtl:tactic) も同じリストで受け渡す。
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+// パラメータの値の種類
+const (
+	paramBool = iota
+	paramUint
+	paramString
+)
+
+// knownParams は設定可能なパラメータとその値の種類の表。
+var knownParams = map[string]int{
+	"auto_config":       paramBool,
+	"debug_ref_count":   paramBool,
+	"dot_proof_file":    paramString,
+	"dump_models":       paramBool,
+	"encoding":          paramString,
+	"model":             paramBool,
+	"model_validate":    paramBool,
+	"proof":             paramBool,
+	"rlimit":            paramUint,
+	"smtlib2_compliant": paramBool,
+	"stats":             paramBool,
+	"timeout":           paramUint,
+	"trace":             paramBool,
+	"trace_file_name":   paramString,
+	"type_check":        paramBool,
+	"unsat_core":        paramBool,
+	"well_sorted_check": paramBool,
+}
+
+// パラメータの設定先
+const (
+	targetContext = iota // コンテクストのパラメータ
+	targetSolver         // ソルバーのパラメータ
+	targetLogic          // ソルバーのロジック
+	targetTactic         // ソルバーを作成するタクティク (value はカンマ区切りの並び)
+)
+
+// param はパラメータの名前と値の組。
+type param struct {
+	key    string
+	value  string
+	target int
+}
+
+// parseParam は key=value 形式の文字列をパラメータとして解釈する関数。
+func parseParam(s string) (p param, err error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		err = fmt.Errorf("%s is not key=value", s)
+		return
+	}
+	p.key = strings.TrimSpace(s[:i])
+	p.value = strings.TrimSpace(s[i+1:])
+
+	// 既知のパラメータかどうか、値の種類が正しいかどうかをチェックする。
+	// コンテクストのパラメータでなければソルバーのパラメータとしてチェックする。
+	kind, ok := knownParams[p.key]
+	if !ok {
+		p.target = targetSolver
+		err = z3.CheckSolverParam(p.key, p.value)
+		return
+	}
+	switch kind {
+	case paramBool:
+		if p.value != "true" && p.value != "false" {
+			err = fmt.Errorf("value of %s must be true or false", p.key)
+		}
+	case paramUint:
+		if _, e := strconv.ParseUint(p.value, 10, 32); e != nil {
+			err = fmt.Errorf("value of %s must be unsigned integer", p.key)
+		}
+	}
+	return
+}
+
+// paramList は -set オプションで指定されたパラメータのリスト。
+type paramList []param
+
+// String は flag.Value のメソッド。
+func (l *paramList) String() string {
+	var ss []string
+	for _, p := range *l {
+		ss = append(ss, p.key+"="+p.value)
+	}
+	return strings.Join(ss, ",")
+}
+
+// Set は flag.Value のメソッド。
+func (l *paramList) Set(s string) (err error) {
+	var p param
+	p, err = parseParam(s)
+	if err == nil {
+		*l = append(*l, p)
+	}
+	return
+}
+
+// configParams はコンテクストの作成に使用するパラメータのリストを返す。
+// SMTL ファイルの //smtl:option、-timeout などのオプション、-set の順に
+// 適用されるため、同じパラメータの場合は後のものが優先される。
+func (opts *options) configParams(fileParams []param) (params []param) {
+	params = append(params, fileParams...)
+	if opts.timeout > 0 {
+		params = append(params, param{key: "timeout", value: strconv.FormatInt(opts.timeout.Milliseconds(), 10)})
+	}
+	if opts.rlimit > 0 {
+		params = append(params, param{key: "rlimit", value: strconv.FormatUint(uint64(opts.rlimit), 10)})
+	}
+	if opts.logic != "" {
+		params = append(params, param{key: "logic", value: opts.logic, target: targetLogic})
+	}
+	params = append(params, opts.params...)
+	return
+}
+
+// parseTactic は //smtl:tactic のタクティクの並びをパラメータとして解釈する関数。
+func parseTactic(s string) (p param, err error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	if err = z3.CheckTactics(names); err != nil {
+		return
+	}
+	p = param{key: "tactic", value: strings.Join(names, ","), target: targetTactic}
+	return
+}
+
+// interruptOn は stop が閉じられたときにコンテクストで実行中の解決を中断する関数。
+// 返された関数は監視を終了するもので、コンテクストを Close する前に呼び出す。
+func interruptOn(ctx *z3.Context, stop <-chan struct{}) (release func()) {
+	if stop == nil {
+		return func() {}
+	}
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-stop:
+		case <-done:
+			return
+		}
+		// Z3_interrupt は実行中の解決のみを中断するため、
+		// 後続の解決も中断されるよう監視を終了するまで繰り返す
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			z3.Interrupt(ctx)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// newContext はパラメータを設定したコンテクストオブジェクトを作成する関数。
+// コンテクストのパラメータ以外は newSmtSolver でソルバーに設定する。
+func newContext(params []param) *z3.Context {
+	config := z3.NewConfig()
+	for _, p := range params {
+		if p.target == targetContext {
+			config.SetParamValue(p.key, p.value)
+		}
+	}
+	ctx := z3.NewContext(config)
+	config.Close()
+	return ctx
+}
@@ -0,0 +1,271 @@
+// 定数と変数の値の上書き
+// -D name=value やパラメータファイルで指定した値によって、SMTL ファイルの
+// main 関数直下で宣言された const の値を置き換え、var の値を固定する。
+// これにより、一つの SMTL ファイルを与件の異なる複数の問題に使用できる。
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// define は上書きする定数もしくは変数の名前と値の組。
+type define struct {
+	name  string
+	value string
+}
+
+// parseDefine は name=value 形式の文字列を定義として解釈する関数。
+func parseDefine(s string) (d define, err error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		err = fmt.Errorf("%s is not name=value", s)
+		return
+	}
+	d.name = strings.TrimSpace(s[:i])
+	d.value = strings.TrimSpace(s[i+1:])
+	if !token.IsIdentifier(d.name) {
+		err = fmt.Errorf("%s is not identifier", d.name)
+		return
+	}
+	_, err = defineExpr(d)
+	return
+}
+
+// defineExpr は定義の値を SMTL の式に変換する関数。
+// 値には整数、true および false を使用できる。
+func defineExpr(d define) (expr ast.Expr, err error) {
+	switch d.value {
+	case "true", "false":
+		expr = ast.NewIdent(d.value)
+	default:
+		if _, e := strconv.ParseInt(d.value, 10, 0); e != nil {
+			err = fmt.Errorf("value of %s must be integer, true or false", d.name)
+			return
+		}
+		expr = &ast.BasicLit{Kind: token.INT, Value: d.value}
+	}
+	return
+}
+
+// defineList は -D オプションで指定された定義のリスト。
+type defineList []define
+
+// String は flag.Value のメソッド。
+func (l *defineList) String() string {
+	var ss []string
+	for _, d := range *l {
+		ss = append(ss, d.name+"="+d.value)
+	}
+	return strings.Join(ss, ",")
+}
+
+// Set は flag.Value のメソッド。
+func (l *defineList) Set(s string) (err error) {
+	var d define
+	d, err = parseDefine(s)
+	if err == nil {
+		*l = append(*l, d)
+	}
+	return
+}
+
+// loadDefines はパラメータファイルから定義のリストを読み込む関数。
+// 拡張子が .yaml もしくは .yml のファイルは YAML、それ以外は JSON として読み込む。
+// いずれも名前と値の組を並べただけの平坦なものに限られる。
+func loadDefines(path string) (defines []define, err error) {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		defines, err = loadDefinesYAML(path)
+	default:
+		defines, err = loadDefinesJSON(path)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %s", path, err)
+	}
+	return
+}
+
+// loadDefinesJSON は {"n": 9, "flag": true} の形式の JSON ファイルを読み込む関数。
+func loadDefinesJSON(path string) (defines []define, err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	if err = dec.Decode(&values); err != nil {
+		return
+	}
+	defines, err = definesFromJSON(values)
+	return
+}
+
+// definesFromJSON は JSON をデコードした名前と値の表を定義のリストに変換する関数。
+// 値は json.Number もしくは bool でなければならない。
+func definesFromJSON(values map[string]interface{}) (defines []define, err error) {
+	// 名前の順に並べる
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		d := define{name: name, value: fmt.Sprint(values[name])}
+		switch values[name].(type) {
+		case json.Number, bool:
+		default:
+			err = fmt.Errorf("value of %s must be integer, true or false", name)
+			return
+		}
+		if _, err = defineExpr(d); err != nil {
+			return
+		}
+		defines = append(defines, d)
+	}
+	return
+}
+
+// loadDefinesYAML は "n: 9" の形式の行を並べた YAML ファイルを読み込む関数。
+// 入れ子のマッピングやシーケンスには対応していない。
+func loadDefinesYAML(path string) (defines []define, err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		// コメントと空行は読み飛ばす
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line == "---" {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			err = fmt.Errorf("line %d: %s is not name: value", lineNo, line)
+			return
+		}
+		d := define{name: strings.TrimSpace(line[:i]), value: strings.TrimSpace(line[i+1:])}
+		if !token.IsIdentifier(d.name) {
+			err = fmt.Errorf("line %d: %s is not identifier", lineNo, d.name)
+			return
+		}
+		if _, err = defineExpr(d); err != nil {
+			err = fmt.Errorf("line %d: %s", lineNo, err)
+			return
+		}
+		defines = append(defines, d)
+	}
+	err = scanner.Err()
+	return
+}
+
+// applyDefines はステートメントリストの const の値を定義の値で置き換え、
+// var については定義の値と等しいという制約を追加したステートメントリストを返す関数。
+// 同じ名前の定義が複数ある場合は後のものが優先される。
+// 定義された名前が main 関数直下で宣言されていない場合はエラーとなる。
+func applyDefines(stmts []ast.Stmt, defines []define) (r []ast.Stmt, err error) {
+	if len(defines) == 0 {
+		r = stmts
+		return
+	}
+
+	values := map[string]ast.Expr{}
+	for _, d := range defines {
+		values[d.name], err = defineExpr(d)
+		if err != nil {
+			return
+		}
+	}
+
+	used := map[string]bool{}
+	for _, stmt := range stmts {
+		ds, ok := stmt.(*ast.DeclStmt)
+		if !ok {
+			r = append(r, stmt)
+			continue
+		}
+		gd, ok := ds.Decl.(*ast.GenDecl)
+		if !ok {
+			r = append(r, stmt)
+			continue
+		}
+
+		// 値を置き換える宣言は、元のステートメントリストを変更しないよう複製する
+		specs := append([]ast.Spec{}, gd.Specs...)
+		replaced := false
+		var asserts []ast.Stmt
+		for j, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				value, ok := values[name.Name]
+				if !ok {
+					continue
+				}
+				used[name.Name] = true
+
+				// const と初期値のある var は値を置き換える
+				if len(vs.Values) == len(vs.Names) {
+					if specs[j] == spec {
+						c := *vs
+						c.Values = append([]ast.Expr{}, vs.Values...)
+						specs[j] = &c
+					}
+					specs[j].(*ast.ValueSpec).Values[i] = value
+					replaced = true
+					continue
+				}
+				if gd.Tok == token.CONST {
+					continue
+				}
+
+				// 初期値のない var は制約を追加する
+				asserts = append(asserts, &ast.ExprStmt{X: &ast.CallExpr{
+					Fun: ast.NewIdent("assert"),
+					Args: []ast.Expr{&ast.BinaryExpr{
+						X:  ast.NewIdent(name.Name),
+						Op: token.EQL,
+						Y:  value,
+					}},
+				}})
+			}
+		}
+		if replaced {
+			c := *gd
+			c.Specs = specs
+			stmt = &ast.DeclStmt{Decl: &c}
+		}
+		r = append(r, stmt)
+		r = append(r, asserts...)
+	}
+
+	for _, d := range defines {
+		if !used[d.name] {
+			err = fmt.Errorf("%s is not declared as const or var", d.name)
+			return
+		}
+	}
+	return
+}
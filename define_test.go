@@ -0,0 +1,35 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"testing"
+)
+
+// TestApplyDefines は定義の値で const と var を置き換えても、元のステートメントリストが
+// 変更されないことを確かめる。
+func TestApplyDefines(t *testing.T) {
+	stmts, err := parseSmtlStmts("const n = 1\nvar x int = 2\nvar y int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defines := []define{{name: "n", value: "3"}, {name: "x", value: "4"}, {name: "y", value: "5"}}
+	r, err := applyDefines(stmts, defines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := func(stmt ast.Stmt) string {
+		vs := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		return types.ExprString(vs.Values[0])
+	}
+	if got := value(r[0]) + "," + value(r[1]); got != "3,4" {
+		t.Errorf("defined values = %s, want 3,4", got)
+	}
+	if got := types.ExprString(r[3].(*ast.ExprStmt).X); got != "assert(y == 5)" {
+		t.Errorf("assertion = %s, want assert(y == 5)", got)
+	}
+	if got := value(stmts[0]) + "," + value(stmts[1]); got != "1,2" {
+		t.Errorf("original values = %s, want 1,2", got)
+	}
+}
@@ -0,0 +1,113 @@
+// SMT-LIB 2 形式への書き出し
+// SMTL ファイルの変数と制約関係を、SMT-LIB 2 形式の declare-const と assert の並びとして
+// 書き出す。制約の式は z3 の AST の文字列表現 (Z3_ast_to_string) をそのまま使用する。
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	exportCmdFmt = "Usage: %s [options] export [-o file] file.smtl...\n"
+)
+
+// runExport は export コマンドを実行する関数。
+func runExport(opts *options, args []string) int {
+	// export コマンドのオプションの処理
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	outPath := fset.String("o", "", "write SMT-LIB 2 into `file` (default stdout)")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, exportCmdFmt, os.Args[0])
+		fset.PrintDefaults()
+	}
+	smtlFilePaths, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(smtlFilePaths) == 0 {
+		fset.Usage()
+		return exitUsage
+	}
+
+	// 結果の出力先
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err = exportFiles(w, smtlFilePaths, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitSat
+}
+
+// exportFiles は SMTL ファイルの変数と制約関係を SMT-LIB 2 形式で w に書き出す関数。
+func exportFiles(w io.Writer, smtlFilePaths []string, opts *options) (err error) {
+	solver, varTab, err := translateFiles(smtlFilePaths, opts)
+	if solver != nil {
+		defer solver.ctx.Close()
+		defer solver.Close()
+	}
+	if err != nil {
+		return
+	}
+
+	// check 文と prove 文はその時点の制約で解決するため、一つの問題として書き出せない
+	if solver.checks > 0 {
+		err = fmt.Errorf("check and prove cannot be exported")
+		return
+	}
+
+	// ソフト制約のグループ名は空白などを含められるよう |name| の形のシンボルとして書き出す。
+	// | と \ はこの形のシンボルに含められない。
+	for _, soft := range solver.Softs() {
+		if strings.ContainsAny(soft.group, `|\`) {
+			err = fmt.Errorf("group %q of soft cannot be exported", soft.group)
+			return
+		}
+	}
+
+	// 変数の宣言
+	var names []string
+	for name, v := range varTab {
+		if !v.isConst && v.dims == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sortName := "Int"
+		if varTab[name].sort == sortBool {
+			sortName = "Bool"
+		}
+		fmt.Fprintf(w, "(declare-const %s %s)\n", varTab[name].x, sortName)
+	}
+
+	// 制約とソフト制約
+	for _, x := range solver.Asserts() {
+		fmt.Fprintf(w, "(assert %s)\n", x)
+	}
+	for _, soft := range solver.Softs() {
+		if soft.group == "" {
+			fmt.Fprintf(w, "(assert-soft %s :weight %d)\n", soft.x, soft.weight)
+		} else {
+			fmt.Fprintf(w, "(assert-soft %s :weight %d :id |%s|)\n", soft.x, soft.weight, soft.group)
+		}
+	}
+	fmt.Fprintln(w, "(check-sat)")
+	fmt.Fprintln(w, "(get-model)")
+	return
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestExportSoftGroup はソフト制約のグループ名が |name| の形のシンボルとして書き出されることを確かめる。
+func TestExportSoftGroup(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		group string
+		want  string
+		err   string
+	}{
+		{"g", ":id |g|)", ""},
+		{"a b)", ":id |a b)|)", ""},
+		{"a|b", "", `group "a|b" of soft cannot be exported`},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, strings.Repeat("a", i+1)+".smtl")
+		src := "package smtl\n\nfunc main() {\n\tvar x int\n\tsoft(x == 1, 1, " + strconv.Quote(test.group) + ")\n}\n"
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		err := exportFiles(&b, []string{path}, &options{})
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: want error %q, got %v", test.group, test.err, err)
+			}
+		case err != nil:
+			t.Errorf("%q: %s", test.group, err)
+		case !strings.Contains(b.String(), test.want):
+			t.Errorf("%q: want %q in\n%s", test.group, test.want, b.String())
+		}
+	}
+}
@@ -0,0 +1,527 @@
+// SMTL ファイルの整形
+// SMTL は golang の構文に従うため、go/printer で gofmt と同じ規則により整形した上で、
+// SMTL 向けの次の規則を適用する。
+//
+//   - main 関数の中で連続する var 宣言は、一つの var ( ... ) にまとめて型を揃える
+//     (間にコメントがある場合はまとめない)
+//   - -sort を指定した場合は、まとめた var 宣言の中を変数名の順に並べる
+//     (初期値や配列の長さで他の変数を参照する宣言は、その変数の後に置いたままとする)
+//
+// 整形した結果は再びパースし、宣言と制約が元の SMTL ファイルと同じであることを確認する。
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	fmtCmdFmt = "Usage: %s [options] fmt [-l] [-d] [-w] [-sort] [-o file] file.smtl|dir...\n"
+)
+
+// fmtOptions は fmt コマンドのオプションを保持する構造体。
+type fmtOptions struct {
+	list    bool   // 整形されていないファイルの名前を表示する
+	diff    bool   // 整形前と整形後の差分を表示する
+	write   bool   // 整形した結果でファイルを書き換える
+	sort    bool   // var 宣言の中を変数名の順に並べる
+	outPath string // 整形した結果を書き出すファイル
+}
+
+// runFmt は fmt コマンドを実行する関数。
+func runFmt(opts *options, args []string) int {
+	// fmt コマンドのオプションの処理
+	var fopts fmtOptions
+	fset := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fset.BoolVar(&fopts.list, "l", false, "list files whose formatting differs")
+	fset.BoolVar(&fopts.diff, "d", false, "display diffs instead of formatted SMTL")
+	fset.BoolVar(&fopts.write, "w", false, "write result to source file instead of stdout")
+	fset.BoolVar(&fopts.sort, "sort", false, "sort variables in grouped var declarations")
+	fset.StringVar(&fopts.outPath, "o", "", "write formatted SMTL into `file` (single file only)")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, fmtCmdFmt, os.Args[0])
+		fset.PrintDefaults()
+	}
+	args, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) == 0 || (fopts.outPath != "" && len(args) != 1) {
+		fset.Usage()
+		return exitUsage
+	}
+
+	// ディレクトリが指定された場合はその中の SMTL ファイルを整形する
+	var paths []string
+	for _, arg := range args {
+		if arg == stdinPath {
+			paths = append(paths, arg)
+			continue
+		}
+		var found []string
+		found, err = findSmtlFiles([]string{arg})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		paths = append(paths, found...)
+	}
+
+	code := exitSat
+	for _, path := range paths {
+		changed, err := fmtSmtlFile(os.Stdout, path, &fopts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		// -l と -d では整形されていないファイルがあることを終了コードで示す
+		if changed && (fopts.list || fopts.diff) {
+			code = exitFail
+		}
+	}
+	return code
+}
+
+// fmtSmtlFile は SMTL ファイルを整形し、fopts に応じて結果を出力する関数。
+// 整形によって内容が変わったかどうかを返す。
+func fmtSmtlFile(w io.Writer, smtlFilePath string, fopts *fmtOptions) (changed bool, err error) {
+	var src []byte
+	if smtlFilePath == stdinPath {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(smtlFilePath)
+	}
+	if err != nil {
+		return
+	}
+
+	var res []byte
+	res, err = formatSmtl(smtlFilePath, src, fopts.sort)
+	if err != nil {
+		return
+	}
+	// 改行コードが CRLF の SMTL ファイルは CRLF のまま整形する
+	if bytes.Contains(src, []byte("\r\n")) {
+		res = bytes.ReplaceAll(res, []byte("\n"), []byte("\r\n"))
+	}
+	changed = !bytes.Equal(src, res)
+
+	switch {
+	case fopts.list || fopts.diff:
+		if changed && fopts.list {
+			fmt.Fprintln(w, smtlFilePath)
+		}
+		if changed && fopts.diff {
+			writeDiff(w, smtlFilePath, src, res)
+		}
+	case fopts.write:
+		if changed && smtlFilePath != stdinPath {
+			err = os.WriteFile(smtlFilePath, res, 0644)
+		}
+	case fopts.outPath != "":
+		err = os.WriteFile(fopts.outPath, res, 0644)
+	default:
+		_, err = w.Write(res)
+	}
+	return
+}
+
+// formatSmtl は SMTL のソースを整形する関数。
+func formatSmtl(filename string, src []byte, sortVars bool) (res []byte, err error) {
+	fset := token.NewFileSet()
+	fileNode, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	before := stmtsDigest(fileNode)
+
+	// main 関数の中の連続する var 宣言をまとめる
+	for _, decl := range fileNode.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if ok && fd.Body != nil {
+			fd.Body.List = groupVarDecls(fset, fd.Body.List, fileNode.Comments, sortVars)
+		}
+	}
+
+	// まとめても宣言の順は変わらない。並べ替えた場合は並べ替えた後の順と比べる。
+	if !sortVars && stmtsDigest(fileNode) != before {
+		err = fmt.Errorf("%s: formatting changed statements", filename)
+		return
+	}
+	before = stmtsDigest(fileNode)
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err = cfg.Fprint(&buf, fset, fileNode); err != nil {
+		return
+	}
+	res = buf.Bytes()
+
+	// 整形した結果の宣言と制約が元と同じであることを確認する
+	fileNode, err = parser.ParseFile(token.NewFileSet(), filename, res, 0)
+	if err != nil {
+		err = fmt.Errorf("%s: formatted SMTL cannot be parsed: %s", filename, err)
+		return
+	}
+	if after := stmtsDigest(fileNode); after != before {
+		err = fmt.Errorf("%s: formatting changed statements", filename)
+	}
+	return
+}
+
+// groupVarDecls はステートメントリストの中の連続する var 宣言を一つにまとめる関数。
+// ブロックの中のステートメントリストも同様にまとめる。
+func groupVarDecls(fset *token.FileSet, stmts []ast.Stmt, comments []*ast.CommentGroup, sortVars bool) (r []ast.Stmt) {
+	for i := 0; i < len(stmts); {
+		if bs, ok := stmts[i].(*ast.BlockStmt); ok {
+			bs.List = groupVarDecls(fset, bs.List, comments, sortVars)
+		}
+
+		// 括弧を使わない var 宣言が連続する範囲 [i, j) を探す。
+		// 間にコメントがある場合と、最後の宣言の行末にコメントがある場合はまとめない。
+		j := i
+		for j < len(stmts) && isVarDecl(stmts[j]) && !stmts[j].(*ast.DeclStmt).Decl.(*ast.GenDecl).Lparen.IsValid() && (j == i || !hasComment(comments, stmts[j-1].End(), stmts[j].Pos())) {
+			j++
+		}
+		if j-i >= 2 && hasTrailingComment(fset, comments, stmts[j-1]) {
+			j--
+		}
+		if j-i < 2 {
+			if sortVars && isVarDecl(stmts[i]) {
+				sortVarSpecs(stmts[i].(*ast.DeclStmt).Decl.(*ast.GenDecl), comments)
+			}
+			r = append(r, stmts[i])
+			i++
+			continue
+		}
+
+		// 最初の var 宣言に残りの宣言をまとめる
+		first := stmts[i].(*ast.DeclStmt).Decl.(*ast.GenDecl)
+		group := &ast.GenDecl{TokPos: first.TokPos, Tok: token.VAR, Lparen: first.TokPos + 4}
+		for _, stmt := range stmts[i:j] {
+			group.Specs = append(group.Specs, stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl).Specs...)
+		}
+		group.Rparen = stmts[j-1].End()
+		if sortVars {
+			sortVarSpecs(group, comments)
+		}
+		r = append(r, &ast.DeclStmt{Decl: group})
+		i = j
+	}
+	return
+}
+
+// isVarDecl はステートメントが var 宣言かどうかを判定する関数。
+func isVarDecl(stmt ast.Stmt) bool {
+	ds, ok := stmt.(*ast.DeclStmt)
+	if !ok {
+		return false
+	}
+	gd, ok := ds.Decl.(*ast.GenDecl)
+	return ok && gd.Tok == token.VAR
+}
+
+// hasComment は範囲 [from, to) にコメントがあるかどうかを判定する関数。
+func hasComment(comments []*ast.CommentGroup, from, to token.Pos) bool {
+	for _, cg := range comments {
+		if cg.Pos() >= from && cg.Pos() < to {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTrailingComment はステートメントの行末にコメントがあるかどうかを判定する関数。
+func hasTrailingComment(fset *token.FileSet, comments []*ast.CommentGroup, stmt ast.Stmt) bool {
+	line := fset.Position(stmt.End()).Line
+	for _, cg := range comments {
+		if cg.Pos() >= stmt.End() && fset.Position(cg.Pos()).Line == line {
+			return true
+		}
+	}
+	return false
+}
+
+// sortVarSpecs はまとめた var 宣言の中を最初の変数名の順に並べ替える関数。
+// 並べ替えた後も各宣言の行の順に表示されるよう、位置は元の順のまま入れ替える。
+// 中にコメントがある場合はコメントの位置がずれるため並べ替えない。
+// 互いに参照しない宣言の連続する範囲ごとに並べ替え、var z = 1; var a = z のように
+// 他の宣言を参照する宣言は参照される宣言の後に置いたままとする。
+func sortVarSpecs(gd *ast.GenDecl, comments []*ast.CommentGroup) {
+	if !gd.Lparen.IsValid() || len(gd.Specs) < 2 || hasComment(comments, gd.Pos(), gd.End()) {
+		return
+	}
+	var positions []token.Pos
+	for _, spec := range gd.Specs {
+		positions = append(positions, spec.Pos())
+	}
+	for i := 0; i < len(gd.Specs); {
+		j := i + 1
+		for j < len(gd.Specs) && independentSpec(gd.Specs[i:j], gd.Specs[j].(*ast.ValueSpec)) {
+			j++
+		}
+		run := gd.Specs[i:j]
+		sort.SliceStable(run, func(a, b int) bool {
+			return run[a].(*ast.ValueSpec).Names[0].Name < run[b].(*ast.ValueSpec).Names[0].Name
+		})
+		i = j
+	}
+	for i, spec := range gd.Specs {
+		movePos(spec.(*ast.ValueSpec), positions[i])
+	}
+}
+
+// independentSpec は var 宣言 vs と宣言のリスト specs が互いの名前を参照していないかを判定する関数。
+func independentSpec(specs []ast.Spec, vs *ast.ValueSpec) bool {
+	for _, spec := range specs {
+		other := spec.(*ast.ValueSpec)
+		if refersTo(vs, other) || refersTo(other, vs) {
+			return false
+		}
+	}
+	return true
+}
+
+// refersTo は var 宣言 vs の型もしくは初期値が、宣言 other の名前を参照しているかを判定する関数。
+func refersTo(vs, other *ast.ValueSpec) (found bool) {
+	names := map[string]bool{}
+	for _, name := range other.Names {
+		names[name.Name] = true
+	}
+	var nodes []ast.Node
+	if vs.Type != nil {
+		nodes = append(nodes, vs.Type)
+	}
+	for _, value := range vs.Values {
+		nodes = append(nodes, value)
+	}
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && names[id.Name] {
+				found = true
+			}
+			return !found
+		})
+	}
+	return
+}
+
+// movePos は var 宣言の位置を pos に移動する関数。
+// 移動先の行は元の宣言の行より短いことがあり、相対的な位置を保つと次の行にはみ出して
+// 途中で改行されるため、名前、型および値の位置はすべて pos とし、一行に表示する。
+func movePos(vs *ast.ValueSpec, pos token.Pos) {
+	ast.Inspect(vs, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.Ident:
+			n.(*ast.Ident).NamePos = pos
+		case *ast.BasicLit:
+			n.(*ast.BasicLit).ValuePos = pos
+		case *ast.BinaryExpr:
+			n.(*ast.BinaryExpr).OpPos = pos
+		case *ast.UnaryExpr:
+			n.(*ast.UnaryExpr).OpPos = pos
+		case *ast.ParenExpr:
+			n.(*ast.ParenExpr).Lparen = pos
+			n.(*ast.ParenExpr).Rparen = pos
+		case *ast.CallExpr:
+			n.(*ast.CallExpr).Lparen = pos
+			n.(*ast.CallExpr).Rparen = pos
+		case *ast.ArrayType:
+			n.(*ast.ArrayType).Lbrack = pos
+		case *ast.IndexExpr:
+			n.(*ast.IndexExpr).Lbrack = pos
+			n.(*ast.IndexExpr).Rbrack = pos
+		case *ast.SelectorExpr:
+			// Sel は Ident として移動する
+		}
+		return true
+	})
+}
+
+// stmtsDigest はファイルの宣言と main 関数のステートメントを、
+// 位置や var 宣言のまとめ方によらない文字列として返す関数。
+// 宣言の順は区別するため、並べ替えた場合は並べ替えた後の AST と比べること。
+// 整形の前後で宣言と制約が変わっていないことの確認に使う。
+func stmtsDigest(fileNode *ast.File) string {
+	var lines []string
+	for _, decl := range fileNode.Decls {
+		switch decl.(type) {
+		case *ast.GenDecl:
+			lines = append(lines, genDeclDigest(decl.(*ast.GenDecl))...)
+		case *ast.FuncDecl:
+			fd := decl.(*ast.FuncDecl)
+			lines = append(lines, "func "+fd.Name.Name+types.ExprString(fd.Type))
+			if fd.Body != nil {
+				lines = append(lines, stmtListDigest(fd.Body.List)...)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// genDeclDigest は宣言を一つの名前ごとの文字列のリストとして返す関数。
+func genDeclDigest(gd *ast.GenDecl) (lines []string) {
+	for _, spec := range gd.Specs {
+		switch spec.(type) {
+		case *ast.ValueSpec:
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				line := gd.Tok.String() + " " + name.Name
+				if vs.Type != nil {
+					line += " " + types.ExprString(vs.Type)
+				}
+				if i < len(vs.Values) {
+					line += " = " + types.ExprString(vs.Values[i])
+				}
+				lines = append(lines, line)
+			}
+		case *ast.ImportSpec:
+			lines = append(lines, "import "+spec.(*ast.ImportSpec).Path.Value)
+		}
+	}
+	return
+}
+
+// stmtListDigest はステートメントリストを文字列のリストとして返す関数。
+// 宣言は名前ごとの行とするため、連続する var 宣言はまとめた場合と同じになる。
+func stmtListDigest(stmts []ast.Stmt) (lines []string) {
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.DeclStmt:
+			if gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl); ok {
+				lines = append(lines, genDeclDigest(gd)...)
+			}
+		case *ast.ExprStmt:
+			lines = append(lines, types.ExprString(stmt.(*ast.ExprStmt).X))
+		case *ast.BlockStmt:
+			lines = append(lines, "{")
+			lines = append(lines, stmtListDigest(stmt.(*ast.BlockStmt).List)...)
+			lines = append(lines, "}")
+		default:
+			lines = append(lines, fmt.Sprintf("%T", stmt))
+		}
+	}
+	return
+}
+
+// writeDiff は整形前と整形後の差分を unified 形式で出力する関数。
+func writeDiff(w io.Writer, name string, src, res []byte) {
+	a := splitLines(src)
+	b := splitLines(res)
+
+	// 最長共通部分列の長さの表
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// 各行の編集内容 (' ' は共通、'-' は削除、'+' は追加)
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+
+	// 前後 3 行の共通部分を含むハンクごとに出力する
+	const context = 3
+	fmt.Fprintf(w, "--- %s.orig\n+++ %s\n", name, name)
+	aLine, bLine := 1, 1
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			aLine++
+			bLine++
+			k++
+			continue
+		}
+		// ハンクの範囲 [start, end) を求める
+		start := k - context
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			n := end
+			for n < len(edits) && edits[n].op == ' ' {
+				n++
+			}
+			if n == len(edits) || n-end > 2*context {
+				if n-end > context {
+					n = end + context
+				}
+				end = n
+				break
+			}
+			end = n
+		}
+
+		aStart, bStart := aLine-(k-start), bLine-(k-start)
+		var aCount, bCount int
+		var hunk strings.Builder
+		for _, e := range edits[start:end] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			hunk.WriteString(string(e.op) + line)
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n%s", aStart, aCount, bStart, bCount, hunk.String())
+		aLine, bLine = aStart+aCount, bStart+bCount
+		k = end
+	}
+}
+
+// splitLines はテキストを改行を含む行のリストに分割する関数。
+func splitLines(text []byte) []string {
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
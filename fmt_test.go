@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFormatSort は -sort で互いに参照しない var 宣言のみが並べ替えられることを確かめる。
+func TestFormatSort(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// 参照する宣言は参照される宣言の後に置いたまま
+		{"var z = 1\n\tvar a = z", "var (\n\t\tz = 1\n\t\ta = z\n\t)"},
+		// 互いに参照しない範囲ごとに並べる
+		{"var y int\n\tvar x int\n\tvar b = x + y\n\tvar a = b", "var (\n\t\tx int\n\t\ty int\n\t\tb = x + y\n\t\ta = b\n\t)"},
+		// 長い宣言を短い宣言の行に移しても途中で改行しない
+		{"var zz = 1 + 2 + 3\n\tvar a int", "var (\n\t\ta  int\n\t\tzz = 1 + 2 + 3\n\t)"},
+		// 配列の長さで参照する宣言は配列の宣言の前に置いたまま
+		{"var n = 2\n\tvar c [n]int\n\tvar b bool", "var (\n\t\tn = 2\n\t\tb bool\n\t\tc [n]int\n\t)"},
+	}
+	for _, test := range tests {
+		src := "package smtl\n\nfunc main() {\n\t" + test.src + "\n}\n"
+		res, err := formatSmtl("a.smtl", []byte(src), true)
+		if err != nil {
+			t.Errorf("%q: %s", test.src, err)
+			continue
+		}
+		if !strings.Contains(string(res), test.want) {
+			t.Errorf("%q: want\n%s\ngot\n%s", test.src, test.want, res)
+		}
+	}
+}
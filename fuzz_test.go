@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addSmtlSeeds は testdata とリポジトリの SMTL ファイルをシードコーパスに加える。
+func addSmtlSeeds(f *testing.F) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.smtl"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range append(paths, "foo.smtl", "sudoku.smtl") {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(src))
+	}
+}
+
+// writeSmtl は src を一時ファイルに書き出し、そのパスを返す。
+func writeSmtl(t *testing.T, src string) string {
+	path := filepath.Join(t.TempDir(), "fuzz.smtl")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// FuzzParseSmtl は SMTL ファイルのパース (本文、プラグマ、注釈) が
+// どのような入力でもパニックしないことを確かめる。
+func FuzzParseSmtl(f *testing.F) {
+	addSmtlSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		path := writeSmtl(t, src)
+		parseSmtlFiles([]string{path}, nil)
+		parseSmtlPragmas(path)
+		parseSmtlWants(path)
+	})
+}
+
+// FuzzTranslate はパースできた SMTL ファイルの型のチェックと z3 の式への変換が
+// どのような入力でもパニックしないことを確かめる。解決は行わない。
+func FuzzTranslate(f *testing.F) {
+	addSmtlSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		s, _, _ := translateFiles([]string{writeSmtl(t, src)}, &options{})
+		if s != nil {
+			s.Close()
+			s.ctx.Close()
+		}
+	})
+}
@@ -0,0 +1,747 @@
+// SMTL から Go のソースコードを生成する
+// SMTL ファイルの制約関係を、processExpr などが実行時に行うのと同じ z3 の
+// 呼び出し (ctx.Const、Add、Assert など) に変換し、smtrun なしで制約を解決できる
+// Go のパッケージを生成する。生成したパッケージは smtrun の z3 パッケージを使用し、
+// 基数制約・擬似ブール制約も Z3 のネイティブな制約 (z3.AtMost、z3.PbLe など) とする。
+// 生成したパッケージは次の関数と型を持つ。
+//
+//	type Params struct { ... }              // SMTL ファイルの定数
+//	func DefaultParams() Params              // SMTL ファイルに記述された定数の値
+//	type Model struct { ... }               // SMTL ファイルの変数の値
+//	func Solve(params Params) (Model, error) // 制約関係の解決
+//
+// ソフト制約、check、prove およびブロックは生成の対象外であり、エラーとなる。
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	genCmdFmt = "Usage: %s [options] gen [-o file.go] [-pkg name] file.smtl\n"
+)
+
+// genField は生成する構造体のフィールドを表す構造体。
+type genField struct {
+	name  string // SMTL での名前
+	field string // フィールド名
+	sort  string // 型
+	goVar string // Solve の中の変数名 (Model のみ)
+	value string // 既定値 (Params のみ)
+}
+
+// generator は Go のソースコードの生成の状態を保持する構造体。
+type generator struct {
+	body    bytes.Buffer        // Solve の本体
+	varTab  map[string]*smtlVar // 型のチェックに使用する変数テーブル
+	exprs   map[string]string   // 変数と定数に対応する Go の式
+	ints    map[string]string   // int の定数の値を表す Go の int の式
+	params  []genField          // Params のフィールド
+	vars    []genField          // Model のフィールド
+	fields  map[string]string   // フィールド名と SMTL での名前の対応
+	helpers map[string]bool     // 使用した補助関数
+	pbs     int                 // 基数制約・擬似ブール制約の k と重みの変数の数
+}
+
+// runGen は gen コマンドを実行する関数。
+func runGen(opts *options, args []string) int {
+	// gen コマンドのオプションの処理
+	fset := flag.NewFlagSet("gen", flag.ContinueOnError)
+	outPath := fset.String("o", "", "write generated Go source into `file` (default stdout)")
+	pkgName := fset.String("pkg", "model", "package `name` of generated Go source")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, genCmdFmt, os.Args[0])
+		fset.PrintDefaults()
+	}
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(files) != 1 || !token.IsIdentifier(*pkgName) {
+		fset.Usage()
+		return exitUsage
+	}
+
+	src, err := genFile(files[0], *pkgName, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if *outPath == "" {
+		os.Stdout.Write(src)
+	} else if err = os.WriteFile(*outPath, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitSat
+}
+
+// genFile は SMTL ファイルから Go のソースコードを生成する関数。
+func genFile(smtlFilePath string, pkgName string, opts *options) (src []byte, err error) {
+	// SMTL ファイルのパース
+	fileParams, err := parseSmtlPragmas(smtlFilePath)
+	if err != nil {
+		return
+	}
+	stmts, err := parseSmtlFiles([]string{smtlFilePath}, opts.searchPath())
+	if err != nil {
+		return
+	}
+	stmts, err = applyDefines(stmts, opts.defines)
+	if err != nil {
+		return
+	}
+
+	// Solve の本体の生成
+	g := &generator{
+		varTab:  map[string]*smtlVar{},
+		exprs:   map[string]string{},
+		ints:    map[string]string{},
+		fields:  map[string]string{},
+		helpers: map[string]bool{},
+	}
+	for _, stmt := range stmts {
+		if err = g.genStmt(stmt); err != nil {
+			return
+		}
+	}
+
+	// ソースコード全体の組み立て
+	var buf bytes.Buffer
+	name := filepath.Base(smtlFilePath)
+	fmt.Fprintf(&buf, "// Code generated by smtrun gen from %s. DO NOT EDIT.\n\n", name)
+	fmt.Fprintf(&buf, "// Package %s は %s の制約関係を解決する。\n", pkgName, name)
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+	fmt.Fprintf(&buf, "import (\n\"errors\"\n\n\"github.com/bunji2/smtrun/z3\"\n)\n\n")
+	fmt.Fprintf(&buf, "// 解決できなかった場合のエラー\n")
+	fmt.Fprintf(&buf, "var (\nErrUnsat = errors.New(\"unsat\")\nErrUnknown = errors.New(\"unknown\")\n)\n\n")
+
+	fmt.Fprintf(&buf, "// Params は %s の定数の値。\ntype Params struct {\n", name)
+	for _, p := range g.params {
+		fmt.Fprintf(&buf, "%s %s // %s\n", p.field, p.sort, p.name)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+	fmt.Fprintf(&buf, "// DefaultParams は %s に記述された定数の値を返す。\nfunc DefaultParams() Params {\nreturn Params{\n", name)
+	for _, p := range g.params {
+		fmt.Fprintf(&buf, "%s: %s,\n", p.field, p.value)
+	}
+	fmt.Fprintf(&buf, "}\n}\n\n")
+
+	fmt.Fprintf(&buf, "// Model は %s の制約関係を満たす変数の値。\ntype Model struct {\n", name)
+	for _, v := range g.vars {
+		fmt.Fprintf(&buf, "%s %s // %s\n", v.field, v.sort, v.name)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "// Solve は %s の制約関係を解決し、変数の値を返す。\n", name)
+	fmt.Fprintf(&buf, "// 解決不能の場合は ErrUnsat、解決可能かどうか不明の場合は ErrUnknown を返す。\n")
+	fmt.Fprintf(&buf, "func Solve(params Params) (m Model, err error) {\n")
+	fmt.Fprintf(&buf, "config := z3.NewConfig()\n")
+	for _, p := range opts.configParams(fileParams) {
+		if p.target != targetContext {
+			// 生成したソースコードは go-z3 のコンテクストとソルバーを使用するため、コンテクストのパラメータに限る
+			err = fmt.Errorf("%s is not supported by gen", p.key)
+			return
+		}
+		fmt.Fprintf(&buf, "config.SetParamValue(%q, %q)\n", p.key, p.value)
+	}
+	fmt.Fprintf(&buf, "ctx := z3.NewContext(config)\nconfig.Close()\ndefer ctx.Close()\n\n")
+	fmt.Fprintf(&buf, "s := ctx.NewSolver()\ndefer s.Close()\n\n")
+	buf.Write(g.body.Bytes())
+	fmt.Fprintf(&buf, "\nswitch s.Check() {\ncase z3.False:\nerr = ErrUnsat\nreturn\ncase z3.Undef:\nerr = ErrUnknown\nreturn\n}\n\n")
+	fmt.Fprintf(&buf, "model := s.Model()\ndefer model.Close()\n")
+	for _, v := range g.vars {
+		if v.sort == sortInt {
+			fmt.Fprintf(&buf, "m.%s = model.Eval(%s).Int()\n", v.field, v.goVar)
+		} else {
+			fmt.Fprintf(&buf, "m.%s = model.Eval(%s).String() == \"true\"\n", v.field, v.goVar)
+		}
+	}
+	fmt.Fprintf(&buf, "return\n}\n")
+
+	// 使用した補助関数
+	if g.helpers["countTrue"] {
+		fmt.Fprintf(&buf, "\n%s", genCountTrue)
+	}
+	if g.helpers["pbInt"] {
+		fmt.Fprintf(&buf, "\n%s", genPBInt)
+	}
+	if g.helpers["boolAST"] {
+		fmt.Fprintf(&buf, "\n%s", genBoolAST)
+	}
+
+	src, err = format.Source(buf.Bytes())
+	return
+}
+
+// 生成したソースコードで使用する補助関数。
+const (
+	genCountTrue = `// countTrue は bool 式のリストのうち真であるものの個数を表す z3 の AST を作成する。
+func countTrue(ctx *z3.Context, bs ...*z3.AST) *z3.AST {
+	one := ctx.Int(1, ctx.IntSort())
+	zero := ctx.Int(0, ctx.IntSort())
+	var terms []*z3.AST
+	for _, b := range bs {
+		terms = append(terms, b.Ite(one, zero))
+	}
+	return zero.Add(terms...)
+}
+`
+	genPBInt = `// pbInt は基数制約・擬似ブール制約の k もしくは重みの値を 32 ビットの int に変換する。
+// 値が min 未満もしくは 32 ビットの int の範囲外の場合はエラーとする。
+func pbInt(what string, v, min int) (n int32, err error) {
+	if v < min || v > 1<<31-1 {
+		err = errors.New(what + " is out of range")
+		return
+	}
+	n = int32(v)
+	return
+}
+`
+	genBoolAST = `// boolAST は bool の値を表す z3 の AST を作成する。
+func boolAST(ctx *z3.Context, b bool) *z3.AST {
+	if b {
+		return ctx.True()
+	}
+	return ctx.False()
+}
+`
+)
+
+// genStmt はステートメントに対応する Go のコードを生成する。
+func (g *generator) genStmt(stmt ast.Stmt) (err error) {
+	switch stmt.(type) {
+	case *ast.DeclStmt:
+		gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl)
+		if !ok || (gd.Tok != token.VAR && gd.Tok != token.CONST) {
+			err = fmt.Errorf("not supported Tok of DeclStmt")
+			break
+		}
+		for _, spec := range gd.Specs {
+			if gd.Tok == token.VAR {
+				err = g.genVarSpec(spec.(*ast.ValueSpec))
+			} else {
+				err = g.genConstSpec(spec.(*ast.ValueSpec))
+			}
+			if err != nil {
+				break
+			}
+		}
+
+	case *ast.ExprStmt:
+		ce, ok := stmt.(*ast.ExprStmt).X.(*ast.CallExpr)
+		if !ok {
+			err = fmt.Errorf("not supported Stmt")
+			break
+		}
+		fun, ok := ce.Fun.(*ast.Ident)
+		if !ok || (fun.Name != "assert" && fun.Name != "assume") {
+			err = fmt.Errorf("%s is not supported by gen", types.ExprString(ce.Fun))
+			break
+		}
+		if len(ce.Args) != 1 {
+			err = fmt.Errorf("%s must have single argument", fun.Name)
+			break
+		}
+		var x string
+		x, err = g.genBoolExpr(ce.Args[0])
+		if err == nil {
+			fmt.Fprintf(&g.body, "s.Assert(%s)\n", x)
+		}
+
+	case *ast.BlockStmt:
+		err = fmt.Errorf("block is not supported by gen")
+
+	default:
+		err = fmt.Errorf("not supported Stmt")
+	}
+	return
+}
+
+// genVarSpec は変数宣言に対応する Go のコードを生成する。
+func (g *generator) genVarSpec(vs *ast.ValueSpec) (err error) {
+	// 初期値
+	var values []string
+	var sorts []string
+	for _, value := range vs.Values {
+		var x, sort string
+		sort, err = exprSort(g.varTab, value)
+		if err == nil {
+			x, err = g.genExpr(value)
+		}
+		if err != nil {
+			return
+		}
+		values = append(values, x)
+		sorts = append(sorts, sort)
+	}
+	if len(values) > 0 && len(values) != len(vs.Names) {
+		err = fmt.Errorf("%s: %d names but %d values", vs.Names[0].Name, len(vs.Names), len(vs.Values))
+		return
+	}
+
+	// 型
+	var sortName string
+	switch vs.Type.(type) {
+	case *ast.Ident:
+		sortName = vs.Type.(*ast.Ident).Name
+	case nil:
+		if len(values) == 0 {
+			err = fmt.Errorf("var %s must have type or value", vs.Names[0].Name)
+			return
+		}
+		sortName = sorts[0]
+	case *ast.ArrayType:
+		err = fmt.Errorf("array var %s is not supported by gen", vs.Names[0].Name)
+		return
+	default:
+		err = fmt.Errorf("not supported Type of ValueSpec")
+		return
+	}
+	if sortName != sortInt && sortName != sortBool {
+		err = fmt.Errorf("type %s is not supported", sortName)
+		return
+	}
+
+	for i, name := range vs.Names {
+		if _, ok := g.varTab[name.Name]; ok {
+			err = fmt.Errorf("var %s is already declared", name.Name)
+			return
+		}
+		var field string
+		field, err = g.fieldName(name.Name)
+		if err != nil {
+			return
+		}
+		goVar := "v" + strconv.Itoa(len(g.vars))
+		g.varTab[name.Name] = &smtlVar{sort: sortName}
+		g.exprs[name.Name] = goVar
+		g.vars = append(g.vars, genField{name: name.Name, field: field, sort: sortName, goVar: goVar})
+
+		sortFunc := "IntSort"
+		if sortName == sortBool {
+			sortFunc = "BoolSort"
+		}
+		fmt.Fprintf(&g.body, "%s := ctx.Const(ctx.Symbol(%q), ctx.%s())\n", goVar, name.Name, sortFunc)
+		if len(values) > 0 {
+			if sorts[i] != sortName {
+				err = fmt.Errorf("cannot use %s (%s) as %s value of var %s", types.ExprString(vs.Values[i]), sorts[i], sortName, name.Name)
+				return
+			}
+			fmt.Fprintf(&g.body, "s.Assert(%s.Eq(%s))\n", goVar, values[i])
+		}
+	}
+	return
+}
+
+// genConstSpec は定数宣言を処理する。
+// 値がリテラルの定数は Params のフィールドとなり、その他の定数は値の式に展開される。
+func (g *generator) genConstSpec(vs *ast.ValueSpec) (err error) {
+	if len(vs.Values) != len(vs.Names) {
+		err = fmt.Errorf("const %s must have value", vs.Names[0].Name)
+		return
+	}
+	for i, name := range vs.Names {
+		value := vs.Values[i]
+		if err = checkConstExpr(g.varTab, value); err != nil {
+			return
+		}
+		var sort string
+		sort, err = exprSort(g.varTab, value)
+		if err != nil {
+			return
+		}
+		if _, ok := g.varTab[name.Name]; ok {
+			err = fmt.Errorf("const %s is already declared", name.Name)
+			return
+		}
+		if vs.Type != nil && types.ExprString(vs.Type) != sort {
+			err = fmt.Errorf("cannot use %s (%s) as %s value of const %s", types.ExprString(value), sort, types.ExprString(vs.Type), name.Name)
+			return
+		}
+
+		var x, goInt string
+		if lit, ok := genLiteral(value); ok {
+			// リテラルの定数は Params から値を得る
+			var field string
+			field, err = g.fieldName(name.Name)
+			if err != nil {
+				return
+			}
+			g.params = append(g.params, genField{name: name.Name, field: field, sort: sort, value: lit})
+			if sort == sortInt {
+				x = fmt.Sprintf("ctx.Int(params.%s, ctx.IntSort())", field)
+				goInt = "params." + field
+			} else {
+				x = fmt.Sprintf("boolAST(ctx, params.%s)", field)
+				g.helpers["boolAST"] = true
+			}
+		} else {
+			x, err = g.genExpr(value)
+			if err == nil && sort == sortInt {
+				goInt, err = g.genInt(value)
+			}
+			if err != nil {
+				return
+			}
+		}
+		g.varTab[name.Name] = &smtlVar{sort: sort, isConst: true, val: constValue(g.varTab, value)}
+		g.exprs[name.Name] = x
+		if sort == sortInt {
+			g.ints[name.Name] = goInt
+		}
+	}
+	return
+}
+
+// genLiteral は定数の値がリテラルであれば、その Go の表記を返す関数。
+func genLiteral(expr ast.Expr) (lit string, ok bool) {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		// 生成するコードの ctx.Int は 32 ビットの値しか扱えない
+		if v, e := strconv.ParseInt(bl.Value, 0, 32); bl.Kind == token.INT && e == nil {
+			lit, ok = strconv.FormatInt(v, 10), true
+		}
+	case *ast.Ident:
+		name := expr.(*ast.Ident).Name
+		ok = name == "true" || name == "false"
+		lit = name
+	}
+	return
+}
+
+// fieldName は SMTL での名前から構造体のフィールド名を作る。
+// latin.x のような修飾した名前は LatinX となる。
+func (g *generator) fieldName(name string) (field string, err error) {
+	for _, part := range strings.Split(name, ".") {
+		r, size := utf8.DecodeRuneInString(part)
+		field += string(unicode.ToUpper(r)) + part[size:]
+	}
+	if !ast.IsExported(field) {
+		field = "V" + field
+	}
+	if other, ok := g.fields[field]; ok {
+		err = fmt.Errorf("%s and %s have same field name %s", other, name, field)
+		return
+	}
+	g.fields[field] = name
+	return
+}
+
+// genBoolExpr は bool 型の式に対応する Go の式を生成する。
+func (g *generator) genBoolExpr(expr ast.Expr) (x string, err error) {
+	var sort string
+	sort, err = exprSort(g.varTab, expr)
+	if err == nil && sort != sortBool {
+		err = fmt.Errorf("%s is not bool", types.ExprString(expr))
+	}
+	if err == nil {
+		x, err = g.genExpr(expr)
+	}
+	return
+}
+
+// genExpr は式に対応する Go の式を生成する。processExpr と同じ go-z3 の呼び出しとなる。
+func (g *generator) genExpr(expr ast.Expr) (x string, err error) {
+	switch expr.(type) {
+	case *ast.Ident:
+		ident := expr.(*ast.Ident)
+		switch ident.Name {
+		case "true":
+			x = "ctx.True()"
+		case "false":
+			x = "ctx.False()"
+		default:
+			var ok bool
+			if x, ok = g.exprs[ident.Name]; !ok {
+				err = fmt.Errorf("%s is unknown variable", ident.Name)
+			}
+		}
+
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		lit, ok := genLiteral(bl)
+		if !ok {
+			err = fmt.Errorf("%s is out of range of 32-bit int", bl.Value)
+			break
+		}
+		x = fmt.Sprintf("ctx.Int(%s, ctx.IntSort())", lit)
+
+	case *ast.ParenExpr:
+		x, err = g.genExpr(expr.(*ast.ParenExpr).X)
+
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		var l, r string
+		l, err = g.genExpr(be.X)
+		if err == nil {
+			r, err = g.genExpr(be.Y)
+		}
+		if err != nil {
+			break
+		}
+		switch be.Op {
+		case token.ADD:
+			x = fmt.Sprintf("%s.Add(%s)", l, r)
+		case token.SUB:
+			x = fmt.Sprintf("%s.Sub(%s)", l, r)
+		case token.MUL:
+			x = fmt.Sprintf("%s.Mul(%s)", l, r)
+		case token.LAND:
+			x = fmt.Sprintf("%s.And(%s)", l, r)
+		case token.LOR:
+			x = fmt.Sprintf("%s.Or(%s)", l, r)
+		case token.EQL:
+			x = fmt.Sprintf("%s.Eq(%s)", l, r)
+		case token.LSS:
+			x = fmt.Sprintf("%s.Lt(%s)", l, r)
+		case token.GTR:
+			x = fmt.Sprintf("%s.Gt(%s)", l, r)
+		case token.NEQ:
+			x = fmt.Sprintf("%s.Eq(%s).Not()", l, r)
+		case token.LEQ:
+			x = fmt.Sprintf("%s.Le(%s)", l, r)
+		case token.GEQ:
+			x = fmt.Sprintf("%s.Ge(%s)", l, r)
+		default:
+			err = fmt.Errorf("not supported bop")
+		}
+
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		if ue.Op != token.NOT {
+			err = fmt.Errorf("not supported bop")
+			break
+		}
+		x, err = g.genExpr(ue.X)
+		x += ".Not()"
+
+	case *ast.CallExpr:
+		x, err = g.genCallExpr(expr.(*ast.CallExpr))
+
+	default:
+		err = fmt.Errorf("not supported Expr")
+	}
+	return
+}
+
+// genCallExpr は関数呼び出しに対応する Go の式を生成する。processBuiltin と同じ go-z3 の呼び出しとなる。
+func (g *generator) genCallExpr(ce *ast.CallExpr) (x string, err error) {
+	var args []string
+	for _, arg := range ce.Args {
+		var a string
+		a, err = g.genExpr(arg)
+		if err != nil {
+			return
+		}
+		args = append(args, a)
+	}
+	if len(args) == 0 {
+		err = fmt.Errorf("too few argument of CallExpr")
+		return
+	}
+
+	switch ce.Fun.(type) {
+	case *ast.Ident:
+		name := ce.Fun.(*ast.Ident).Name
+		switch name {
+		case "distinct":
+			if len(args) < 2 {
+				err = fmt.Errorf("distinct must have 2 arguments at least")
+				break
+			}
+			x = fmt.Sprintf("%s.Distinct(%s)", args[0], strings.Join(args[1:], ", "))
+		case "sum":
+			x = fmt.Sprintf("%s.Add(%s)", args[0], strings.Join(args[1:], ", "))
+		case "count":
+			x = g.genHelper("countTrue", args)
+		case "min", "max":
+			x = args[0]
+			for _, a := range args[1:] {
+				if name == "min" {
+					x = fmt.Sprintf("%s.Lt(%s).Ite(%s, %s)", a, x, a, x)
+				} else {
+					x = fmt.Sprintf("%s.Gt(%s).Ite(%s, %s)", a, x, a, x)
+				}
+			}
+		case "abs":
+			if len(args) != 1 {
+				err = fmt.Errorf("abs must have single argument")
+				break
+			}
+			zero := "ctx.Int(0, ctx.IntSort())"
+			x = fmt.Sprintf("%s.Ge(%s).Ite(%s, %s.Sub(%s))", args[0], zero, args[0], zero, args[0])
+		case "atMost", "atLeast", "exactly", "pbLe", "pbGe", "pbEq":
+			x, err = g.genPBCall(name, ce.Args, args)
+		default:
+			err = fmt.Errorf("not supported Name of Indent")
+		}
+
+	case *ast.SelectorExpr:
+		se := ce.Fun.(*ast.SelectorExpr)
+		var e string
+		e, err = g.genExpr(se.X)
+		if err != nil {
+			break
+		}
+		if len(args) != 1 {
+			err = fmt.Errorf("%s must have single argument", se.Sel.Name)
+			break
+		}
+		switch se.Sel.Name {
+		case "implies":
+			x = fmt.Sprintf("%s.Implies(%s)", e, args[0])
+		case "iff":
+			x = fmt.Sprintf("%s.Iff(%s)", e, args[0])
+		default:
+			err = fmt.Errorf("not supported Sel.Name of SelectorExpr")
+		}
+
+	default:
+		err = fmt.Errorf("not supported Fun of CallExpr")
+	}
+	return
+}
+
+// genHelper は補助関数の呼び出しを生成する。
+func (g *generator) genHelper(name string, args []string) string {
+	g.helpers[name] = true
+	return fmt.Sprintf("%s(ctx, %s)", name, strings.Join(args, ", "))
+}
+
+// genPBCall は基数制約・擬似ブール制約に対応する Go の式を生成する。processPBCall と同じく
+// z3.AtMost などのネイティブな制約とし、k と重みは int の定数式でなければならない。
+// k と重みは Params で変更できるため、32 ビットの範囲 (atMost などの k は非負) であることを
+// 生成したコードの実行時にもチェックする。
+func (g *generator) genPBCall(name string, exprs []ast.Expr, args []string) (x string, err error) {
+	var k string
+	k, err = g.genPBInt(name, "k", exprs[0])
+	if err != nil {
+		return
+	}
+
+	switch name {
+	case "atMost", "atLeast", "exactly":
+		if len(args) < 2 {
+			err = fmt.Errorf("%s must have 2 arguments at least", name)
+			return
+		}
+		bs := strings.Join(args[1:], ", ")
+		switch name {
+		case "atMost":
+			x = fmt.Sprintf("z3.AtMost(ctx, []*z3.AST{%s}, uint(%s))", bs, k)
+		case "atLeast":
+			x = fmt.Sprintf("z3.AtLeast(ctx, []*z3.AST{%s}, uint(%s))", bs, k)
+		default:
+			// exactly は重みがすべて 1 の擬似ブール制約とする
+			ones := strings.TrimSuffix(strings.Repeat("1, ", len(args)-1), ", ")
+			x = fmt.Sprintf("z3.PbEq(ctx, []*z3.AST{%s}, []int32{%s}, %s)", bs, ones, k)
+		}
+
+	default:
+		if len(args) < 3 || len(args)%2 == 0 {
+			err = fmt.Errorf("%s must have k and pairs of weight and bool", name)
+			return
+		}
+		var bs, coeffs []string
+		for i := 1; i+1 < len(args); i += 2 {
+			var w string
+			w, err = g.genPBInt(name, "weight", exprs[i])
+			if err != nil {
+				return
+			}
+			coeffs = append(coeffs, w)
+			bs = append(bs, args[i+1])
+		}
+		f := map[string]string{"pbLe": "PbLe", "pbGe": "PbGe", "pbEq": "PbEq"}[name]
+		x = fmt.Sprintf("z3.%s(ctx, []*z3.AST{%s}, []int32{%s}, %s)", f, strings.Join(bs, ", "), strings.Join(coeffs, ", "), k)
+	}
+	return
+}
+
+// genPBInt は基数制約・擬似ブール制約の k もしくは重みを 32 ビットの int に変換する
+// Go のコードを生成し、その値を保持する変数名を返す。Params によらない値はその値を返す。
+// processPBCall と同じく、定数式であること、32 ビットの範囲であること、
+// atMost などの k が負でないことをここでチェックする。
+func (g *generator) genPBInt(name, what string, expr ast.Expr) (goVar string, err error) {
+	var n int32
+	n, err = pbInt(g.varTab, name, what, expr)
+	if err != nil {
+		return
+	}
+	min := "-1 << 31"
+	if what == "k" && (name == "atMost" || name == "atLeast" || name == "exactly") {
+		if n < 0 {
+			err = fmt.Errorf("k of %s must not be negative", name)
+			return
+		}
+		min = "0"
+	}
+	var v string
+	v, err = g.genInt(expr)
+	if err != nil {
+		return
+	}
+	if !strings.Contains(v, "params.") {
+		// Params によらない値はここでチェックした値とする
+		goVar = strconv.Itoa(int(n))
+		return
+	}
+	g.helpers["pbInt"] = true
+	goVar = "pb" + strconv.Itoa(g.pbs)
+	g.pbs++
+	fmt.Fprintf(&g.body, "%s, err := pbInt(%q, %s, %s)\nif err != nil {\nreturn\n}\n", goVar, what+" of "+name, v, min)
+	return
+}
+
+// genInt は int の定数式に対応する Go の int の式を生成する。
+func (g *generator) genInt(expr ast.Expr) (x string, err error) {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		lit, ok := genLiteral(expr)
+		if !ok {
+			err = fmt.Errorf("%s is out of range of 32-bit int", expr.(*ast.BasicLit).Value)
+			break
+		}
+		x = lit
+
+	case *ast.Ident:
+		var ok bool
+		if x, ok = g.ints[expr.(*ast.Ident).Name]; !ok {
+			err = fmt.Errorf("%s is not constant int", expr.(*ast.Ident).Name)
+		}
+
+	case *ast.ParenExpr:
+		x, err = g.genInt(expr.(*ast.ParenExpr).X)
+
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		var l, r string
+		l, err = g.genInt(be.X)
+		if err == nil {
+			r, err = g.genInt(be.Y)
+		}
+		if err == nil {
+			x = fmt.Sprintf("(%s %s %s)", l, be.Op, r)
+		}
+
+	default:
+		err = fmt.Errorf("%s is not constant int", types.ExprString(expr))
+	}
+	return
+}
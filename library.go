@@ -0,0 +1,757 @@
+// SMTL ライブラリのインポート
+// SMTL ファイルは import "lib/latin" のように他の SMTL パッケージをインポートし、
+// そのパッケージで宣言された関数、定数および変数を latin.AllDifferent(...) のように
+// パッケージ名で修飾して使用できる。
+// パッケージはディレクトリの中の SMTL ファイル (*.smtl) の集まりであり、
+// 検索パスの各ディレクトリからインポートパスをたどって探す。
+//
+// インポートしたパッケージの定数と変数の宣言は "latin.N" のように修飾した名前で
+// main 関数のステートメントリストの前に追加される。
+// 関数は本体が return 文一つだけのものに限られ、呼び出した箇所で引数を
+// 代入した本体の式に展開される。
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SMTL パッケージの検索パスを指定する環境変数
+	smtlPathEnv = "SMTLPATH"
+
+	// 関数の展開の入れ子の深さの上限
+	maxExpandDepth = 100
+
+	// 関数を展開した式のノードの数の上限
+	maxExpandSize = 100000
+)
+
+// pathList は -I オプションで指定されたディレクトリのリスト。
+type pathList []string
+
+// String は flag.Value のメソッド。
+func (l *pathList) String() string {
+	return strings.Join(*l, string(filepath.ListSeparator))
+}
+
+// Set は flag.Value のメソッド。
+func (l *pathList) Set(s string) (err error) {
+	*l = append(*l, s)
+	return
+}
+
+// searchPath は SMTL パッケージの検索パスを返す。
+// -I で指定されたディレクトリ、環境変数 SMTLPATH のディレクトリの順に探す。
+// confine の場合は -I で指定されたディレクトリのみとする。
+func (opts *options) searchPath() (dirs []string) {
+	dirs = append(dirs, opts.includes...)
+	if opts.confine {
+		return
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(smtlPathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return
+}
+
+// smtlPackage は読み込んだ SMTL パッケージを表す構造体。
+type smtlPackage struct {
+	name  string               // パッケージ名
+	path  string               // インポートパス (main 関数のあるパッケージは "")
+	decls []ast.Stmt           // 修飾した名前による const と var の宣言
+	names map[string]bool      // パッケージレベルで宣言された定数と変数の名前
+	funcs map[string]*smtlFunc // パッケージレベルで宣言された関数
+	pos   map[string]token.Pos // パッケージレベルで宣言された名前の位置
+}
+
+// qualify はパッケージレベルの名前を varTab で使用する名前に変換する。
+// main 関数のあるパッケージの名前は修飾しない。
+func (pkg *smtlPackage) qualify(name string) string {
+	if pkg.path == "" {
+		return name
+	}
+	return pkg.name + "." + name
+}
+
+// smtlFunc は SMTL の関数を表す構造体。
+type smtlFunc struct {
+	name     string
+	pkg      *smtlPackage
+	imports  map[string]*smtlPackage // 関数を宣言したファイルでインポートしたパッケージ
+	params   []string                // 仮引数の名前
+	variadic bool                    // 最後の仮引数が可変長 (xs ...int) か
+	body     ast.Expr                // return 文の式
+}
+
+// linkScope は式の中の名前を解決するためのスコープ。
+type linkScope struct {
+	pkg      *smtlPackage
+	imports  map[string]*smtlPackage
+	args     map[string]ast.Expr  // 仮引数に対応する実引数
+	rest     string               // 可変長の仮引数の名前
+	restArgs []ast.Expr           // 可変長の仮引数に対応する実引数
+	declared map[string]token.Pos // main 関数の中で宣言された名前の位置 (重複の検出用)
+	fn       *smtlFunc            // 展開中の関数 (関数の本体でない場合は nil)
+}
+
+// linker は SMTL パッケージを読み込み、一つのステートメントリストにまとめる構造体。
+type linker struct {
+	fset       *token.FileSet
+	searchPath []string
+	pkgs       map[string]*smtlPackage // 読み込んだパッケージ (インポートパスごと)
+	pkgNames   map[string]string       // パッケージ名とインポートパスの対応
+	loading    []string                // 読み込み中のインポートパス (循環の検出用)
+	order      []*smtlPackage          // 依存される順に並べたパッケージ
+	expanding  map[*smtlFunc]bool      // 展開中の関数 (再帰の検出用)
+	depth      int                     // 展開中の関数の入れ子の深さ
+}
+
+// linkSmtlFiles は SMTL ファイルがインポートしたパッケージを読み込み、
+// 各パッケージの宣言と main 関数のステートメントを一つのリストにまとめる関数。
+// 複数の SMTL ファイルは一つのパッケージとして扱い、各ファイルの main 関数の
+// ステートメントを順に並べる。
+func linkSmtlFiles(fset *token.FileSet, fileNodes []*ast.File, searchPath []string) (stmts []ast.Stmt, err error) {
+	l := &linker{
+		fset:       fset,
+		searchPath: searchPath,
+		pkgs:       map[string]*smtlPackage{},
+		pkgNames:   map[string]string{},
+		expanding:  map[*smtlFunc]bool{},
+	}
+
+	// main 関数のあるファイルを一つのパッケージとして読み込む
+	mainPkg := &smtlPackage{name: smtlPkgName}
+	var imports []map[string]*smtlPackage
+	imports, err = l.loadFiles(mainPkg, fileNodes)
+	if err != nil {
+		return
+	}
+	l.order = append(l.order, mainPkg)
+
+	// 依存される順に各パッケージの宣言を並べる
+	for _, pkg := range l.order {
+		stmts = append(stmts, pkg.decls...)
+	}
+
+	// 各ファイルの main 関数のステートメントの中の名前を解決する。
+	// 宣言の重複は両方の位置を示すため、ここで検出する。
+	declared := map[string]token.Pos{}
+	for name, pos := range mainPkg.pos {
+		declared[name] = pos
+	}
+	for i, fileNode := range fileNodes {
+		var body []ast.Stmt
+		body, err = l.rewriteStmts(&linkScope{pkg: mainPkg, imports: imports[i], declared: declared}, mainStmts(fileNode))
+		if err != nil {
+			return
+		}
+		stmts = append(stmts, body...)
+	}
+	return
+}
+
+// loadPackage はインポートパスのパッケージを検索パスから探して読み込む関数。
+func (l *linker) loadPackage(path string, pos token.Pos) (pkg *smtlPackage, err error) {
+	if pkg = l.pkgs[path]; pkg != nil {
+		return
+	}
+	if err = checkImportPath(path); err != nil {
+		err = fmt.Errorf("%s: %s", l.fset.Position(pos), err)
+		return
+	}
+
+	// インポートの循環の検出
+	for i, p := range l.loading {
+		if p == path {
+			err = fmt.Errorf("%s: import cycle: %s -> %s", l.fset.Position(pos), strings.Join(l.loading[i:], " -> "), path)
+			return
+		}
+	}
+	l.loading = append(l.loading, path)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	// 検索パスからパッケージのディレクトリを探す
+	var files []string
+	for _, dir := range l.searchPath {
+		files, _ = filepath.Glob(filepath.Join(dir, filepath.FromSlash(path), "*.smtl"))
+		if len(files) > 0 {
+			break
+		}
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("%s: cannot find package %q in any of %s", l.fset.Position(pos), path, strings.Join(l.searchPath, ", "))
+		return
+	}
+	sort.Strings(files)
+
+	// パッケージの各ファイルをパースする
+	var fileNodes []*ast.File
+	for _, file := range files {
+		var fileNode *ast.File
+		fileNode, err = parseSmtlSource(l.fset, file, 0)
+		if err != nil {
+			return
+		}
+		if len(fileNodes) > 0 && fileNode.Name.Name != fileNodes[0].Name.Name {
+			err = fmt.Errorf("%s: package %s and %s are in the same directory", file, fileNodes[0].Name.Name, fileNode.Name.Name)
+			return
+		}
+		fileNodes = append(fileNodes, fileNode)
+	}
+
+	pkg = &smtlPackage{name: fileNodes[0].Name.Name, path: path}
+	if pkg.name == smtlPkgName {
+		err = fmt.Errorf("%s: package %s cannot be imported", files[0], smtlPkgName)
+		return
+	}
+	if other, ok := l.pkgNames[pkg.name]; ok {
+		err = fmt.Errorf("%s: package name %s of %q conflicts with %q", l.fset.Position(pos), pkg.name, path, other)
+		return
+	}
+	l.pkgNames[pkg.name] = path
+
+	_, err = l.loadFiles(pkg, fileNodes)
+	if err != nil {
+		return
+	}
+	l.pkgs[path] = pkg
+	l.order = append(l.order, pkg)
+	return
+}
+
+// checkImportPath はインポートパスが検索パスのディレクトリの外を指していないかを調べる関数。
+// インポートパスは "lib/latin" のような / で区切った相対パスでなければならず、
+// 絶対パス、空の要素、"." および ".." の要素、\ や glob のメタ文字は使用できない。
+func checkImportPath(path string) (err error) {
+	if path == "" || strings.HasPrefix(path, "/") || filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		err = fmt.Errorf("import path %q must be relative", path)
+		return
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "" || elem == "." || elem == ".." || strings.ContainsAny(elem, `\:*?[`) {
+			err = fmt.Errorf("invalid import path %q", path)
+			return
+		}
+	}
+	return
+}
+
+// loadFiles はパッケージのファイルのインポート、定数、変数および関数の宣言を読み込む関数。
+// 各ファイルでインポートしたパッケージを返す。
+func (l *linker) loadFiles(pkg *smtlPackage, fileNodes []*ast.File) (imports []map[string]*smtlPackage, err error) {
+	pkg.names = map[string]bool{}
+	pkg.funcs = map[string]*smtlFunc{}
+	pkg.pos = map[string]token.Pos{}
+
+	// インポートしたパッケージを読み込み、宣言された名前を集める
+	for _, fileNode := range fileNodes {
+		var fileImports map[string]*smtlPackage
+		fileImports, err = l.loadImports(fileNode)
+		if err != nil {
+			return
+		}
+		imports = append(imports, fileImports)
+
+		for _, decl := range fileNode.Decls {
+			switch decl.(type) {
+			case *ast.GenDecl:
+				gd := decl.(*ast.GenDecl)
+				if gd.Tok != token.CONST && gd.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						if err = l.checkRedeclared(pkg.pos, gd.Tok.String(), name.Name, name.Pos()); err != nil {
+							return
+						}
+						pkg.names[name.Name] = true
+					}
+				}
+
+			case *ast.FuncDecl:
+				fd := decl.(*ast.FuncDecl)
+				if fd.Name.Name == "main" && fd.Recv == nil {
+					if pkg.path != "" {
+						err = fmt.Errorf("%s: func main must not be declared in imported package", l.fset.Position(fd.Pos()))
+						return
+					}
+					continue
+				}
+				var fn *smtlFunc
+				fn, err = l.loadFunc(pkg, fileImports, fd)
+				if err != nil {
+					return
+				}
+				if err = l.checkRedeclared(pkg.pos, "func", fn.name, fd.Name.Pos()); err != nil {
+					return
+				}
+				pkg.funcs[fn.name] = fn
+			}
+		}
+	}
+
+	// 定数と変数の宣言を修飾した名前に書き換える
+	for i, fileNode := range fileNodes {
+		sc := &linkScope{pkg: pkg, imports: imports[i]}
+		for _, decl := range fileNode.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || (gd.Tok != token.CONST && gd.Tok != token.VAR) {
+				continue
+			}
+			var stmts []ast.Stmt
+			stmts, err = l.rewriteStmts(sc, []ast.Stmt{&ast.DeclStmt{Decl: gd}})
+			if err != nil {
+				return
+			}
+			pkg.decls = append(pkg.decls, stmts...)
+		}
+	}
+	return
+}
+
+// loadImports はファイルでインポートしたパッケージを読み込み、
+// パッケージを参照する名前とパッケージの表を返す関数。
+func (l *linker) loadImports(fileNode *ast.File) (imports map[string]*smtlPackage, err error) {
+	imports = map[string]*smtlPackage{}
+	for _, is := range fileNode.Imports {
+		var path string
+		path, err = strconv.Unquote(is.Path.Value)
+		if err != nil {
+			return
+		}
+		var pkg *smtlPackage
+		pkg, err = l.loadPackage(path, is.Pos())
+		if err != nil {
+			return
+		}
+
+		// import l "lib/latin" のように別名を付けた場合はその名前で参照する
+		name := pkg.name
+		if is.Name != nil {
+			name = is.Name.Name
+			if name == "_" || name == "." {
+				err = fmt.Errorf("%s: import %s is not supported", l.fset.Position(is.Pos()), name)
+				return
+			}
+		}
+		if _, ok := imports[name]; ok {
+			err = fmt.Errorf("%s: %s is already imported", l.fset.Position(is.Pos()), name)
+			return
+		}
+		imports[name] = pkg
+	}
+	return
+}
+
+// loadFunc は関数の宣言を読み込む関数。
+// 関数は int もしくは bool の引数と一つの戻り値を持ち、本体は return 文一つでなければならない。
+func (l *linker) loadFunc(pkg *smtlPackage, imports map[string]*smtlPackage, fd *ast.FuncDecl) (fn *smtlFunc, err error) {
+	fn = &smtlFunc{name: fd.Name.Name, pkg: pkg, imports: imports}
+	pos := l.fset.Position(fd.Pos())
+
+	if fd.Recv != nil {
+		err = fmt.Errorf("%s: method %s is not supported", pos, fn.name)
+		return
+	}
+
+	// 仮引数
+	params := fd.Type.Params.List
+	for i, field := range params {
+		typ := field.Type
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok && i == len(params)-1 && len(field.Names) == 1 {
+			typ = ellipsis.Elt
+			fn.variadic = true
+		}
+		if !isSmtlSort(typ) {
+			err = fmt.Errorf("%s: type %s of parameter is not supported", pos, types.ExprString(typ))
+			return
+		}
+		for _, name := range field.Names {
+			fn.params = append(fn.params, name.Name)
+		}
+	}
+
+	// 戻り値
+	results := fd.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 || !isSmtlSort(results.List[0].Type) {
+		err = fmt.Errorf("%s: func %s must have single int or bool result", pos, fn.name)
+		return
+	}
+
+	// 本体
+	if fd.Body == nil || len(fd.Body.List) != 1 {
+		err = fmt.Errorf("%s: body of func %s must be single return statement", pos, fn.name)
+		return
+	}
+	rs, ok := fd.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(rs.Results) != 1 {
+		err = fmt.Errorf("%s: body of func %s must be single return statement", pos, fn.name)
+		return
+	}
+	fn.body = rs.Results[0]
+	return
+}
+
+// isSmtlSort は型が SMTL の型 (int もしくは bool) かどうかを判定する関数。
+func isSmtlSort(typ ast.Expr) bool {
+	id, ok := typ.(*ast.Ident)
+	return ok && (id.Name == sortInt || id.Name == sortBool)
+}
+
+// rewriteStmts はステートメントの中の名前を解決したステートメントリストを返す関数。
+func (l *linker) rewriteStmts(sc *linkScope, stmts []ast.Stmt) (r []ast.Stmt, err error) {
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.DeclStmt:
+			ds := stmt.(*ast.DeclStmt)
+			gd, ok := ds.Decl.(*ast.GenDecl)
+			if !ok {
+				break
+			}
+			newGd := *gd
+			newGd.Specs = nil
+			for _, spec := range gd.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if !ok {
+					newGd.Specs = append(newGd.Specs, spec)
+					continue
+				}
+				newVs := *vs
+				// パッケージレベルの宣言は修飾した名前にする
+				newVs.Names = nil
+				for _, name := range vs.Names {
+					if sc.declared != nil {
+						if err = l.checkRedeclared(sc.declared, gd.Tok.String(), name.Name, name.Pos()); err != nil {
+							return
+						}
+					}
+					newVs.Names = append(newVs.Names, &ast.Ident{NamePos: name.NamePos, Name: l.declName(sc, name.Name)})
+				}
+				newVs.Values, err = l.rewriteExprs(sc, vs.Values)
+				if err != nil {
+					return
+				}
+				newVs.Type, err = l.rewriteType(sc, vs.Type)
+				if err != nil {
+					return
+				}
+				newGd.Specs = append(newGd.Specs, &newVs)
+			}
+			stmt = &ast.DeclStmt{Decl: &newGd}
+
+		case *ast.ExprStmt:
+			es := stmt.(*ast.ExprStmt)
+			var x ast.Expr
+			x, err = l.rewriteExpr(sc, es.X)
+			if err != nil {
+				return
+			}
+			stmt = &ast.ExprStmt{X: x}
+
+		case *ast.BlockStmt:
+			bs := stmt.(*ast.BlockStmt)
+			// ブロックの中の宣言はブロックの外では破棄される
+			blockSc := *sc
+			if sc.declared != nil {
+				blockSc.declared = map[string]token.Pos{}
+				for name, pos := range sc.declared {
+					blockSc.declared[name] = pos
+				}
+			}
+			var list []ast.Stmt
+			list, err = l.rewriteStmts(&blockSc, bs.List)
+			if err != nil {
+				return
+			}
+			stmt = &ast.BlockStmt{Lbrace: bs.Lbrace, List: list, Rbrace: bs.Rbrace}
+		}
+		r = append(r, stmt)
+	}
+	return
+}
+
+// checkRedeclared は名前が既に宣言されていないかを調べ、宣言の位置を記録する関数。
+// 既に宣言されている場合は、両方の宣言の位置を示すエラーとなる。
+func (l *linker) checkRedeclared(declared map[string]token.Pos, kind, name string, pos token.Pos) (err error) {
+	if prev, ok := declared[name]; ok {
+		err = fmt.Errorf("%s: %s %s is already declared at %s", l.fset.Position(pos), kind, name, l.fset.Position(prev))
+		return
+	}
+	declared[name] = pos
+	return
+}
+
+// declName は宣言された名前を varTab で使用する名前に変換する関数。
+// main 関数の中で宣言された名前は修飾しない。
+func (l *linker) declName(sc *linkScope, name string) string {
+	if sc.pkg.names[name] {
+		return sc.pkg.qualify(name)
+	}
+	return name
+}
+
+// rewriteExprs は各式の中の名前を解決した式のリストを返す関数。
+func (l *linker) rewriteExprs(sc *linkScope, exprs []ast.Expr) (r []ast.Expr, err error) {
+	for _, expr := range exprs {
+		var x ast.Expr
+		x, err = l.rewriteExpr(sc, expr)
+		if err != nil {
+			return
+		}
+		r = append(r, x)
+	}
+	return
+}
+
+// rewriteExpr は式の中の名前を解決した式を返す関数。
+// 仮引数は実引数に、パッケージレベルの名前は修飾した名前に置き換え、
+// 関数の呼び出しは本体の式に展開する。
+func (l *linker) rewriteExpr(sc *linkScope, expr ast.Expr) (r ast.Expr, err error) {
+	r = expr
+	switch expr.(type) {
+	case *ast.Ident:
+		ident := expr.(*ast.Ident)
+		if arg, ok := sc.args[ident.Name]; ok {
+			r = &ast.ParenExpr{X: arg}
+		} else if sc.rest != "" && ident.Name == sc.rest {
+			err = fmt.Errorf("%s: %s must be passed as %s...", l.fset.Position(ident.Pos()), sc.rest, sc.rest)
+		} else if sc.pkg.names[ident.Name] {
+			r = &ast.Ident{NamePos: ident.NamePos, Name: sc.pkg.qualify(ident.Name)}
+		} else if sc.fn != nil && ident.Name != "true" && ident.Name != "false" {
+			// 関数の本体の名前は関数を宣言したパッケージで解決し、
+			// 呼び出した箇所の変数を参照しないようにする
+			err = fmt.Errorf("%s: %s is undefined in func %s", l.fset.Position(ident.Pos()), ident.Name, sc.fn.name)
+		}
+
+	case *ast.ParenExpr:
+		pe := expr.(*ast.ParenExpr)
+		var x ast.Expr
+		x, err = l.rewriteExpr(sc, pe.X)
+		r = &ast.ParenExpr{Lparen: pe.Lparen, X: x, Rparen: pe.Rparen}
+
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		var x, y ast.Expr
+		x, err = l.rewriteExpr(sc, be.X)
+		if err == nil {
+			y, err = l.rewriteExpr(sc, be.Y)
+		}
+		r = &ast.BinaryExpr{X: x, OpPos: be.OpPos, Op: be.Op, Y: y}
+
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		var x ast.Expr
+		x, err = l.rewriteExpr(sc, ue.X)
+		r = &ast.UnaryExpr{OpPos: ue.OpPos, Op: ue.Op, X: x}
+
+	case *ast.SelectorExpr:
+		// latin.N のようなインポートしたパッケージの定数と変数
+		se := expr.(*ast.SelectorExpr)
+		pkg := l.importedPackage(sc, se.X)
+		if pkg == nil {
+			break
+		}
+		err = l.checkExported(pkg, se)
+		if err == nil && !pkg.names[se.Sel.Name] {
+			err = fmt.Errorf("%s: %s is not const or var", l.fset.Position(se.Pos()), types.ExprString(se))
+		}
+		if err == nil {
+			r = &ast.Ident{NamePos: se.Sel.NamePos, Name: pkg.qualify(se.Sel.Name)}
+		}
+
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		var x, index ast.Expr
+		x, err = l.rewriteExpr(sc, ie.X)
+		if err == nil {
+			index, err = l.rewriteExpr(sc, ie.Index)
+		}
+		r = &ast.IndexExpr{X: x, Lbrack: ie.Lbrack, Index: index, Rbrack: ie.Rbrack}
+
+	case *ast.CallExpr:
+		r, err = l.rewriteCallExpr(sc, expr.(*ast.CallExpr))
+	}
+	return
+}
+
+// rewriteType は配列の型 ([N][N]int) の長さの式の中の名前を解決した型を返す関数。
+func (l *linker) rewriteType(sc *linkScope, typ ast.Expr) (r ast.Expr, err error) {
+	r = typ
+	at, ok := typ.(*ast.ArrayType)
+	if !ok || at.Len == nil {
+		return
+	}
+	var n, elt ast.Expr
+	n, err = l.rewriteExpr(sc, at.Len)
+	if err == nil {
+		elt, err = l.rewriteType(sc, at.Elt)
+	}
+	r = &ast.ArrayType{Lbrack: at.Lbrack, Len: n, Elt: elt}
+	return
+}
+
+// rewriteCallExpr は関数呼び出しの中の名前を解決した式を返す関数。
+// SMTL の関数の呼び出しは本体の式に展開する。
+func (l *linker) rewriteCallExpr(sc *linkScope, ce *ast.CallExpr) (r ast.Expr, err error) {
+	// 呼び出す関数を探す
+	var fn *smtlFunc
+	fun := ce.Fun
+	switch ce.Fun.(type) {
+	case *ast.Ident:
+		id := ce.Fun.(*ast.Ident)
+		if _, ok := sc.args[id.Name]; !ok {
+			fn = sc.pkg.funcs[id.Name]
+		}
+
+	case *ast.SelectorExpr:
+		se := ce.Fun.(*ast.SelectorExpr)
+		if pkg := l.importedPackage(sc, se.X); pkg != nil {
+			// latin.AllDifferent(...) のようなインポートしたパッケージの関数
+			err = l.checkExported(pkg, se)
+			if err == nil {
+				fn = pkg.funcs[se.Sel.Name]
+				if fn == nil {
+					err = fmt.Errorf("%s: %s is not func", l.fset.Position(se.Pos()), types.ExprString(se))
+				}
+			}
+		} else {
+			// x.implies(y) のような演算
+			var x ast.Expr
+			x, err = l.rewriteExpr(sc, se.X)
+			fun = &ast.SelectorExpr{X: x, Sel: se.Sel}
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	// 実引数の名前を解決する。
+	// f(xs...) の形で可変長の仮引数を渡した場合は、対応する実引数を展開する。
+	var args []ast.Expr
+	for i, arg := range ce.Args {
+		if ce.Ellipsis.IsValid() && i == len(ce.Args)-1 {
+			id, ok := arg.(*ast.Ident)
+			if !ok || sc.rest == "" || id.Name != sc.rest {
+				err = fmt.Errorf("%s: only variadic parameter can be passed with ...", l.fset.Position(ce.Ellipsis))
+				return
+			}
+			args = append(args, sc.restArgs...)
+			break
+		}
+		var x ast.Expr
+		x, err = l.rewriteExpr(sc, arg)
+		if err != nil {
+			return
+		}
+		args = append(args, x)
+	}
+
+	if fn == nil {
+		r = &ast.CallExpr{Fun: fun, Lparen: ce.Lparen, Args: args, Rparen: ce.Rparen}
+		return
+	}
+	r, err = l.expandFunc(fn, args, ce)
+	return
+}
+
+// expandFunc は関数の本体の仮引数を実引数で置き換えた式を返す関数。
+func (l *linker) expandFunc(fn *smtlFunc, args []ast.Expr, ce *ast.CallExpr) (r ast.Expr, err error) {
+	pos := l.fset.Position(ce.Pos())
+
+	// 再帰呼び出しは展開が終わらないためエラーとする
+	if l.expanding[fn] {
+		err = fmt.Errorf("%s: recursive call of %s is not supported", pos, fn.name)
+		return
+	}
+	if l.depth >= maxExpandDepth {
+		err = fmt.Errorf("%s: expansion of %s is nested too deeply (more than %d)", pos, fn.name, maxExpandDepth)
+		return
+	}
+	l.expanding[fn] = true
+	l.depth++
+	defer func() {
+		delete(l.expanding, fn)
+		l.depth--
+	}()
+
+	// 引数の数の確認
+	n := len(fn.params)
+	if fn.variadic {
+		n--
+		if len(args) < n {
+			err = fmt.Errorf("%s: %s must have %d arguments at least", pos, fn.name, n)
+			return
+		}
+	} else if len(args) != n {
+		err = fmt.Errorf("%s: %s must have %d arguments", pos, fn.name, n)
+		return
+	}
+
+	sc := &linkScope{pkg: fn.pkg, imports: fn.imports, args: map[string]ast.Expr{}, fn: fn}
+	for i := 0; i < n; i++ {
+		sc.args[fn.params[i]] = args[i]
+	}
+	if fn.variadic {
+		sc.rest = fn.params[n]
+		sc.restArgs = args[n:]
+	}
+
+	var x ast.Expr
+	x, err = l.rewriteExpr(sc, fn.body)
+	if err != nil {
+		return
+	}
+
+	// 実引数は展開した式の中で共有されるため、同じ実引数を何度も使用する関数の
+	// 入れ子の呼び出しは、展開した式の大きさが指数的に増える
+	if exprSize(x, maxExpandSize) > maxExpandSize {
+		err = fmt.Errorf("%s: expansion of %s is too large (more than %d nodes)", pos, fn.name, maxExpandSize)
+		return
+	}
+	r = &ast.ParenExpr{Lparen: ce.Lparen, X: x, Rparen: ce.Rparen}
+	return
+}
+
+// exprSize は式のノードの数を返す関数。limit を超えた時点で数えるのをやめる。
+func exprSize(expr ast.Expr, limit int) (n int) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if node != nil {
+			n++
+		}
+		return n <= limit
+	})
+	return
+}
+
+// importedPackage は式がインポートしたパッケージを参照する名前であれば、
+// そのパッケージを返す関数。
+func (l *linker) importedPackage(sc *linkScope, x ast.Expr) *smtlPackage {
+	id, ok := x.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	if _, ok := sc.args[id.Name]; ok || sc.pkg.names[id.Name] {
+		return nil
+	}
+	return sc.imports[id.Name]
+}
+
+// checkExported はインポートしたパッケージの名前が公開されているかどうかを調べる関数。
+// Golang と同様に、大文字で始まる名前のみをパッケージの外から参照できる。
+func (l *linker) checkExported(pkg *smtlPackage, se *ast.SelectorExpr) (err error) {
+	if !se.Sel.IsExported() {
+		err = fmt.Errorf("%s: %s is not exported by package %s", l.fset.Position(se.Pos()), se.Sel.Name, pkg.name)
+	}
+	return
+}
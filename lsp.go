@@ -0,0 +1,745 @@
+// SMTL の言語サーバー
+// 標準入出力で LSP (Language Server Protocol) を話し、エディタに次の機能を提供する。
+//
+//   - パースと z3 の AST への変換の誤りの診断 (diagnostics)
+//   - 変数と定数の型の表示 (hover)
+//   - 変数と定数の宣言への移動 (definition)
+//   - 組み込み関数と変数名の補完 (completion)
+//   - main 関数の上に表示する "solve" のコードレンズ (codeLens)
+//
+// 編集中の内容は srcOverlay に登録し、ファイルの代わりにパースする。
+// メッセージは一つずつ順に処理するため、solve の実行中は他の要求を処理しない。
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+const (
+	// solve のコードレンズで実行するコマンド
+	lspSolveCommand = "smtrun.solve"
+
+	// LSP の診断の重大度 (Error)
+	lspSeverityError = 1
+
+	// LSP の補完候補の種類
+	lspKindMethod   = 2
+	lspKindFunction = 3
+	lspKindVariable = 6
+	lspKindConstant = 21
+	lspKindKeyword  = 14
+
+	// JSON-RPC のエラーコード
+	lspMethodNotFound = -32601
+)
+
+// 補完と hover で表示する組み込み関数の説明
+var lspBuiltins = []struct {
+	name   string
+	kind   int
+	detail string
+}{
+	{"assert", lspKindFunction, "assert(b bool): 制約を登録する"},
+	{"assume", lspKindFunction, "assume(b bool): 前提条件を登録する (assert の別名)"},
+	{"soft", lspKindFunction, "soft(b bool, weight int[, group string]): ソフト制約を登録する"},
+	{"check", lspKindFunction, "check(b bool...): その時点での制約関係をチェックする"},
+	{"prove", lspKindFunction, "prove(b bool): 式が常に成り立つことを証明する"},
+	{"distinct", lspKindFunction, "distinct(x1, x2, ...): すべての値が異なる"},
+	{"sum", lspKindFunction, "sum(x1, x2, ...) int: 総和"},
+	{"count", lspKindFunction, "count(b1, b2, ...) int: 真である bool 式の個数"},
+	{"min", lspKindFunction, "min(x1, x2, ...) int: 最小値"},
+	{"max", lspKindFunction, "max(x1, x2, ...) int: 最大値"},
+	{"abs", lspKindFunction, "abs(x int) int: 絶対値"},
+	{"atMost", lspKindFunction, "atMost(k, b1, b2, ...) bool: 真である bool 式が k 個以下"},
+	{"atLeast", lspKindFunction, "atLeast(k, b1, b2, ...) bool: 真である bool 式が k 個以上"},
+	{"exactly", lspKindFunction, "exactly(k, b1, b2, ...) bool: 真である bool 式がちょうど k 個"},
+	{"pbLe", lspKindFunction, "pbLe(k, w1, b1, w2, b2, ...) bool: 真である bool 式の重みの総和が k 以下"},
+	{"pbGe", lspKindFunction, "pbGe(k, w1, b1, w2, b2, ...) bool: 真である bool 式の重みの総和が k 以上"},
+	{"pbEq", lspKindFunction, "pbEq(k, w1, b1, w2, b2, ...) bool: 真である bool 式の重みの総和が k"},
+	{"implies", lspKindMethod, "a.implies(b bool) bool: a ならば b"},
+	{"iff", lspKindMethod, "a.iff(b bool) bool: a と b は同値"},
+	{"var", lspKindKeyword, "var name int|bool: 変数の宣言"},
+	{"const", lspKindKeyword, "const name = value: 定数の宣言"},
+}
+
+// エラーメッセージの先頭の位置 (file:line:col: msg)
+var lspErrPos = regexp.MustCompile(`^(.+):(\d+):(\d+): (.*)$`)
+
+// lspMessage は JSON-RPC のメッセージ。
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+// lspError は JSON-RPC のエラー。
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lspPosition は LSP の位置。character は UTF-16 での列 (0 から始まる)。
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspRange は LSP の範囲。
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspLocation はファイルの中の範囲。
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// lspDiagnostic は診断結果。
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// lspTextDocumentPosition は textDocument/hover などの引数。
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// lspSymbol は変数と定数の宣言の情報。
+type lspSymbol struct {
+	sort    string
+	isConst bool
+	value   string    // 定数の値
+	pos     token.Pos // 宣言の位置
+}
+
+// lspDocument は編集中の SMTL ファイル。
+type lspDocument struct {
+	uri      string
+	path     string
+	text     string
+	fset     *token.FileSet
+	fileNode *ast.File
+	symbols  map[string][]*lspSymbol // 名前ごとの宣言 (ブロックの中の宣言を含む)
+}
+
+// lspServer は言語サーバーの状態を保持する構造体。
+type lspServer struct {
+	opts     *options
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*lspDocument // URI ごとの編集中の SMTL ファイル
+	shutdown bool
+}
+
+// runLsp は lsp コマンドを実行する関数。
+func runLsp(opts *options, args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] lsp\n", os.Args[0])
+		return exitUsage
+	}
+	srv := &lspServer{
+		opts: opts,
+		in:   bufio.NewReader(os.Stdin),
+		out:  os.Stdout,
+		docs: map[string]*lspDocument{},
+	}
+	if err := srv.serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitSat
+}
+
+// serve はメッセージを読み込み、exit 通知を受け取るまで処理する関数。
+func (srv *lspServer) serve() (err error) {
+	for {
+		var msg *lspMessage
+		msg, err = srv.read()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		if msg.Method == "exit" {
+			// shutdown を受け取らずに終了する場合はエラーとする
+			if !srv.shutdown {
+				err = fmt.Errorf("lsp: exit without shutdown")
+			}
+			return
+		}
+
+		result, rpcErr := srv.handle(msg)
+		if msg.ID == nil {
+			// 通知には応答しない
+			continue
+		}
+		resp := &lspMessage{ID: msg.ID, Result: result, Error: rpcErr}
+		if result == nil && rpcErr == nil {
+			resp.Result = json.RawMessage("null")
+		}
+		if err = srv.write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// read は Content-Length ヘッダーに続くメッセージを一つ読み込む関数。
+func (srv *lspServer) read() (msg *lspMessage, err error) {
+	length := -1
+	for {
+		var line string
+		line, err = srv.in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return
+			}
+		}
+	}
+	if length < 0 {
+		err = fmt.Errorf("lsp: missing Content-Length header")
+		return
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(srv.in, body); err != nil {
+		return
+	}
+	msg = &lspMessage{}
+	err = json.Unmarshal(body, msg)
+	return
+}
+
+// write はメッセージを Content-Length ヘッダーを付けて書き出す関数。
+func (srv *lspServer) write(msg *lspMessage) (err error) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(srv.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return
+}
+
+// notify はクライアントに通知を送る関数。
+func (srv *lspServer) notify(method string, params interface{}) {
+	b, _ := json.Marshal(params)
+	srv.write(&lspMessage{Method: method, Params: b})
+}
+
+// handle はメソッドごとにメッセージを処理し、応答の結果を返す関数。
+func (srv *lspServer) handle(msg *lspMessage) (result interface{}, rpcErr *lspError) {
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // 全体の内容を同期する
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{"."}},
+				"codeLensProvider":       map[string]interface{}{},
+				"executeCommandProvider": map[string]interface{}{"commands": []string{lspSolveCommand}},
+			},
+			"serverInfo": map[string]string{"name": "smtrun", "version": VERSION},
+		}
+
+	case "initialized", "$/cancelRequest", "workspace/didChangeConfiguration":
+		// 何もしない
+
+	case "shutdown":
+		srv.shutdown = true
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			srv.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			srv.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			if doc := srv.docs[params.TextDocument.URI]; doc != nil {
+				setSrcOverlay(doc.path, nil)
+				delete(srv.docs, doc.uri)
+			}
+			srv.notify("textDocument/publishDiagnostics", map[string]interface{}{
+				"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{},
+			})
+		}
+
+	case "textDocument/hover":
+		var params lspTextDocumentPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			result = srv.hover(params)
+		}
+
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			result = srv.definition(params)
+		}
+
+	case "textDocument/completion":
+		var params lspTextDocumentPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			result = srv.completion(params)
+		}
+
+	case "textDocument/codeLens":
+		var params lspTextDocumentPosition
+		if json.Unmarshal(msg.Params, &params) == nil {
+			result = srv.codeLens(params.TextDocument.URI)
+		}
+
+	case "workspace/executeCommand":
+		var params struct {
+			Command   string   `json:"command"`
+			Arguments []string `json:"arguments"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && params.Command == lspSolveCommand && len(params.Arguments) == 1 {
+			result = srv.solve(params.Arguments[0])
+		} else {
+			rpcErr = &lspError{Code: lspMethodNotFound, Message: "unknown command " + params.Command}
+		}
+
+	default:
+		if msg.ID != nil {
+			rpcErr = &lspError{Code: lspMethodNotFound, Message: msg.Method + " is not supported"}
+		}
+	}
+	return
+}
+
+// update は編集中の内容を登録し、パースと変換を行って診断結果を送る関数。
+func (srv *lspServer) update(uri, text string) {
+	doc := &lspDocument{uri: uri, path: lspURIToPath(uri), text: text}
+	srv.docs[uri] = doc
+	setSrcOverlay(doc.path, []byte(text))
+
+	diags := srv.analyze(doc)
+	if diags == nil {
+		diags = []lspDiagnostic{}
+	}
+	srv.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diags})
+}
+
+// analyze は SMTL ファイルをパースし、z3 の AST に変換する関数。
+// 宣言の情報を doc に記録し、誤りを診断結果として返す。
+func (srv *lspServer) analyze(doc *lspDocument) (diags []lspDiagnostic) {
+	// パースと名前の解決
+	_, err := parseSmtlPragmas(doc.path)
+	if err != nil {
+		return srv.errorDiags(doc, err, token.NoPos)
+	}
+	doc.fset = token.NewFileSet()
+	stmts, fileNodes, err := parseSmtlFileSet(doc.fset, []string{doc.path}, srv.opts.searchPath())
+	if len(fileNodes) > 0 {
+		doc.fileNode = fileNodes[0]
+	}
+	if err != nil {
+		return srv.errorDiags(doc, err, token.NoPos)
+	}
+	stmts, err = applyDefines(stmts, srv.opts.defines)
+	if err != nil {
+		return srv.errorDiags(doc, err, token.NoPos)
+	}
+
+	// z3 の AST への変換。誤りはステートメントの位置に示す。
+	params := srv.opts.configParams(nil)
+	ctx := newContext(params)
+	defer ctx.Close()
+	solver := newSmtSolver(ctx, params, io.Discard)
+	solver.dryRun = true
+	solver.fset = doc.fset
+	defer solver.Close()
+	doc.symbols = map[string][]*lspSymbol{}
+	diags = srv.translate(doc, ctx, solver, map[string]*smtlVar{}, stmts)
+	return
+}
+
+// translate はステートメントリストを一つずつ z3 の AST に変換し、宣言の情報を記録する関数。
+// ブロックの中の宣言も記録するため、ブロックは中のステートメントリストを変換する。
+func (srv *lspServer) translate(doc *lspDocument, ctx *z3.Context, solver *smtSolver, varTab map[string]*smtlVar, stmts []ast.Stmt) (diags []lspDiagnostic) {
+	for _, stmt := range stmts {
+		var err error
+		if bs, ok := stmt.(*ast.BlockStmt); ok {
+			// ブロック用の変数テーブル
+			blockVarTab := map[string]*smtlVar{}
+			for name, x := range varTab {
+				blockVarTab[name] = x
+			}
+			solver.Push()
+			diags = srv.translate(doc, ctx, solver, blockVarTab, bs.List)
+			solver.Pop()
+		} else {
+			err = processStmt(ctx, solver, varTab, stmt)
+		}
+		if err != nil {
+			return srv.errorDiags(doc, err, stmt.Pos())
+		}
+		if diags != nil {
+			return
+		}
+
+		// 宣言された変数と定数を記録する
+		ds, ok := stmt.(*ast.DeclStmt)
+		if !ok {
+			continue
+		}
+		for _, spec := range ds.Decl.(*ast.GenDecl).Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for _, name := range vs.Names {
+				v := varTab[name.Name]
+				if v == nil {
+					continue
+				}
+				sym := &lspSymbol{sort: v.typeName(), isConst: v.isConst, pos: name.Pos()}
+				if v.isConst {
+					sym.value = v.x.String()
+				}
+				doc.symbols[name.Name] = append(doc.symbols[name.Name], sym)
+			}
+		}
+	}
+	return
+}
+
+// errorDiags はエラーを診断結果に変換する関数。
+// エラーメッセージの先頭に位置があればその位置に、なければ pos の位置に示す。
+func (srv *lspServer) errorDiags(doc *lspDocument, err error, pos token.Pos) (diags []lspDiagnostic) {
+	// パースのエラーは複数の位置を持つ
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			if e.Pos.Filename == doc.path {
+				diags = append(diags, srv.diag(doc, e.Pos.Line, e.Pos.Column, e.Msg))
+			}
+		}
+		if len(diags) > 0 {
+			return
+		}
+	}
+
+	msg := err.Error()
+	if m := lspErrPos.FindStringSubmatch(msg); m != nil && m[1] == doc.path {
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		return []lspDiagnostic{srv.diag(doc, line, col, m[4])}
+	}
+	if pos.IsValid() {
+		if p := doc.fset.Position(pos); p.Filename == doc.path {
+			return []lspDiagnostic{srv.diag(doc, p.Line, p.Column, msg)}
+		}
+	}
+	return []lspDiagnostic{srv.diag(doc, 1, 1, msg)}
+}
+
+// diag は行と列 (1 から始まるバイト単位) の位置から行末までの診断結果を作成する関数。
+func (srv *lspServer) diag(doc *lspDocument, line, col int, msg string) lspDiagnostic {
+	start := lspPos(doc.text, line, col)
+	end := lspPosition{Line: start.Line, Character: utf16Len(lspLine(doc.text, line))}
+	if end.Character <= start.Character {
+		end.Character = start.Character + 1
+	}
+	return lspDiagnostic{
+		Range:    lspRange{Start: start, End: end},
+		Severity: lspSeverityError,
+		Source:   "smtrun",
+		Message:  msg,
+	}
+}
+
+// identAt は LSP の位置にある名前を返す関数。
+// latin.N のようにパッケージで修飾した名前は修飾したまま返す。
+func (doc *lspDocument) identAt(p lspPosition) (name string, ident *ast.Ident) {
+	if doc.fileNode == nil {
+		return
+	}
+	offset := lspOffset(doc.text, p)
+	file := doc.fset.File(doc.fileNode.Pos())
+	if file == nil || offset > file.Size() {
+		return
+	}
+	pos := file.Pos(offset)
+	ast.Inspect(doc.fileNode, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos > n.End() {
+			return false
+		}
+		switch n.(type) {
+		case *ast.SelectorExpr:
+			se := n.(*ast.SelectorExpr)
+			if x, ok := se.X.(*ast.Ident); ok && pos >= se.Sel.Pos() {
+				name, ident = x.Name+"."+se.Sel.Name, se.Sel
+				return false
+			}
+		case *ast.Ident:
+			name, ident = n.(*ast.Ident).Name, n.(*ast.Ident)
+		}
+		return true
+	})
+	return
+}
+
+// lookup は名前の宣言のうち、pos より前で最後のものを返す関数。
+// pos より前に宣言がない場合は最初の宣言を返す。
+func (doc *lspDocument) lookup(name string, pos token.Pos) (sym *lspSymbol) {
+	syms := doc.symbols[name]
+	for _, s := range syms {
+		if sym == nil || (s.pos <= pos && doc.fset.File(s.pos) == doc.fset.File(pos)) {
+			sym = s
+		}
+	}
+	return
+}
+
+// hover は位置にある変数、定数もしくは組み込み関数の説明を返す関数。
+func (srv *lspServer) hover(params lspTextDocumentPosition) interface{} {
+	doc := srv.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+	name, ident := doc.identAt(params.Position)
+	if ident == nil {
+		return nil
+	}
+
+	var text string
+	if sym := doc.lookup(name, ident.Pos()); sym != nil {
+		if sym.isConst {
+			text = fmt.Sprintf("```go\nconst %s %s = %s\n```", name, sym.sort, sym.value)
+		} else {
+			text = fmt.Sprintf("```go\nvar %s %s\n```", name, sym.sort)
+		}
+	} else {
+		for _, b := range lspBuiltins {
+			if b.name == name && b.kind != lspKindKeyword {
+				text = b.detail
+			}
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{"kind": "markdown", "value": text},
+	}
+}
+
+// definition は位置にある変数もしくは定数の宣言の位置を返す関数。
+func (srv *lspServer) definition(params lspTextDocumentPosition) interface{} {
+	doc := srv.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+	name, ident := doc.identAt(params.Position)
+	if ident == nil {
+		return nil
+	}
+	sym := doc.lookup(name, ident.Pos())
+	if sym == nil {
+		return nil
+	}
+
+	// 宣言のあるファイルの内容から LSP の位置を求める
+	p := doc.fset.Position(sym.pos)
+	text := doc.text
+	if p.Filename != doc.path {
+		if src, ok := lookupSrcOverlay(p.Filename); ok {
+			text = string(src)
+		} else if src, err := os.ReadFile(p.Filename); err == nil {
+			text = string(src)
+		}
+	}
+	start := lspPos(text, p.Line, p.Column)
+	end := lspPosition{Line: start.Line, Character: start.Character + utf16Len(name[strings.LastIndex(name, ".")+1:])}
+	return lspLocation{URI: lspPathToURI(p.Filename), Range: lspRange{Start: start, End: end}}
+}
+
+// completion は組み込み関数と宣言された変数および定数の補完候補を返す関数。
+func (srv *lspServer) completion(params lspTextDocumentPosition) interface{} {
+	items := []map[string]interface{}{}
+	for _, b := range lspBuiltins {
+		items = append(items, map[string]interface{}{"label": b.name, "kind": b.kind, "detail": b.detail})
+	}
+	if doc := srv.docs[params.TextDocument.URI]; doc != nil {
+		var names []string
+		for name := range doc.symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sym := doc.symbols[name][0]
+			kind, detail := lspKindVariable, "var "+name+" "+sym.sort
+			if sym.isConst {
+				kind, detail = lspKindConstant, "const "+name+" "+sym.sort+" = "+sym.value
+			}
+			items = append(items, map[string]interface{}{"label": name, "kind": kind, "detail": detail})
+		}
+	}
+	return items
+}
+
+// codeLens は main 関数の上に solve のコードレンズを返す関数。
+func (srv *lspServer) codeLens(uri string) interface{} {
+	lenses := []map[string]interface{}{}
+	doc := srv.docs[uri]
+	if doc == nil || doc.fileNode == nil {
+		return lenses
+	}
+	for _, decl := range doc.fileNode.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Name.Name != "main" || fd.Recv != nil {
+			continue
+		}
+		p := doc.fset.Position(fd.Pos())
+		start := lspPos(doc.text, p.Line, p.Column)
+		lenses = append(lenses, map[string]interface{}{
+			"range":   lspRange{Start: start, End: start},
+			"command": map[string]interface{}{"title": "solve", "command": lspSolveCommand, "arguments": []string{uri}},
+		})
+	}
+	return lenses
+}
+
+// solve は編集中の SMTL ファイルを解決し、結果をメッセージとして表示する関数。
+// 結果の文字列を返す。
+func (srv *lspServer) solve(uri string) interface{} {
+	path := lspURIToPath(uri)
+	var buf bytes.Buffer
+	_, err := solveFiles(&buf, []string{path}, srv.opts, &runStats{})
+	if err != nil {
+		fmt.Fprintln(&buf, err)
+	}
+	result := strings.TrimSpace(buf.String())
+	srv.notify("window/showMessage", map[string]interface{}{"type": 3, "message": result})
+	return result
+}
+
+// lspURIToPath は file スキームの URI をファイルのパスに変換する関数。
+func lspURIToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := u.Path
+	// Windows のドライブ名 (/C:/...) の先頭の "/" を取り除く
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+// lspPathToURI はファイルのパスを file スキームの URI に変換する関数。
+func lspPathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// lspLine はテキストの行 (1 から始まる) の内容を返す関数。
+func lspLine(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+// lspPos は行と列 (1 から始まるバイト単位) を LSP の位置に変換する関数。
+func lspPos(text string, line, col int) lspPosition {
+	s := lspLine(text, line)
+	if col-1 < len(s) {
+		s = s[:col-1]
+	}
+	return lspPosition{Line: line - 1, Character: utf16Len(s)}
+}
+
+// lspOffset は LSP の位置をテキストの先頭からのバイト単位のオフセットに変換する関数。
+func lspOffset(text string, p lspPosition) (offset int) {
+	for i := 0; i < p.Line; i++ {
+		n := strings.IndexByte(text[offset:], '\n')
+		if n < 0 {
+			return len(text)
+		}
+		offset += n + 1
+	}
+	chars := 0
+	for i, r := range text[offset:] {
+		if chars >= p.Character || r == '\n' {
+			return offset + i
+		}
+		chars += len(utf16.Encode([]rune{r}))
+	}
+	return len(text)
+}
+
+// utf16Len は文字列の UTF-16 での長さを返す関数。
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
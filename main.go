@@ -3,71 +3,512 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
 	"os"
 	"sort"
+	"strings"
+	"text/template"
+	"time"
 
-	"github.com/mitchellh/go-z3"
+	"github.com/bunji2/smtrun/z3"
 )
 
 const (
-	cmdFmt = "Usage: %s file.smt\n"
+	cmdFmt = `Usage: %s [options] command [arguments]
+       %s [options] file.smtl...
+
+Commands:
+  solve [-o file] [-var x,y] file.smtl...  solve constraints (default; - reads stdin)
+  check file.smtl...                       check SMTL files without solving
+  vet file.smtl...                         report suspicious constructs in SMTL files
+  fmt [-l] [-d] [-w] [-sort] file.smtl...  format SMTL files
+  export [-o file] file.smtl...            print constraints in SMT-LIB 2 format
+  gen [-o file.go] [-pkg name] file.smtl   generate Go source using go-z3
+  batch [-j n] [-o outdir] dir...          solve SMTL files in directories in parallel
+  test [file.smtl|dir]...                  compare results with want annotations
+  repl                                     start interactive mode
+  lsp                                      start language server over stdio
+  serve [-addr :8080]                      start HTTP server to solve SMTL
+  version                                  print version
+
+Exit codes:
+  0  sat, or command succeeded
+  1  invalid arguments
+  2  error in SMTL file
+  3  unsat, or check() was unsat or prove() was invalid
+  4  unknown, or check() or prove() was unknown
+  5  test failed, fmt -l/-d found unformatted files, or vet reported warnings
+
+Options:
+`
+)
+
+// 終了コード
+const (
+	exitSat     = 0 // 解決可能
+	exitUsage   = 1 // 引数の誤り
+	exitError   = 2 // SMTL ファイルの誤り
+	exitUnsat   = 3 // 解決不能
+	exitUnknown = 4 // 解決可能かどうか不明
+	exitFail    = 5 // test コマンドで期待する解決結果と一致しなかった、fmt -l/-d で整形されていないファイルがあった、または vet で警告があった
 )
 
+// options はコマンドラインオプションを保持する構造体。
+type options struct {
+	timeout   time.Duration      // ソルバーのタイムアウト
+	rlimit    uint               // ソルバーのリソース上限
+	memory    uint               // Z3 が使用するメモリの上限 (メガバイト)
+	logic     string             // ソルバーのロジック
+	params    paramList          // -set で指定されたパラメータ
+	stats     string             // 統計情報の出力形式
+	portfolio int                // 並列に解決する設定の数
+	defines   defineList         // -D およびパラメータファイルで指定された定義
+	defFile   string             // パラメータファイル
+	includes  pathList           // SMTL パッケージを探すディレクトリ
+	quiet     bool               // バージョンを表示しない
+	vars      []string           // 値を表示する変数 (空の場合はすべて)
+	tmpl      *template.Template // モデルを表示するテンプレート
+	grid      bool               // 配列を格子状に並べて表示する
+	stop      <-chan struct{}    // 閉じられたときに解決を中断する (nil の場合は中断しない)
+	confine   bool               // インポートを -I のディレクトリに限る (SMTL ファイルのディレクトリからは探さない)
+	deadline  time.Time          // すべての解決に共通の期限 (ゼロ値の場合は無制限)
+	maxVars   int                // 宣言できる変数 (配列の要素を含む) の数の上限 (0 の場合は無制限)
+	fset      *token.FileSet     // 解決する SMTL ファイルの位置を記録したファイルセット (誤りの位置を示すため)
+}
+
 func main() {
 	os.Exit(run())
 }
 
 func run() int {
+	// オプションの処理
+	var opts options
+	flag.DurationVar(&opts.timeout, "timeout", 0, "timeout of solver (e.g. 10s)")
+	flag.UintVar(&opts.rlimit, "rlimit", 0, "resource limit of solver")
+	flag.UintVar(&opts.memory, "memory", 0, "memory limit of Z3 in `megabytes`")
+	flag.Var(&opts.params, "set", "set solver parameter `key=value` (repeatable)")
+	flag.StringVar(&opts.logic, "logic", "", "create solver for `logic` (e.g. QF_LIA)")
+	flag.StringVar(&opts.stats, "stats", "", "print statistics in `format` (text or json)")
+	flag.IntVar(&opts.portfolio, "portfolio", 1, "solve with `n` configurations in parallel and take the first answer")
+	flag.Var(&opts.defines, "D", "override const or var with `name=value` (repeatable)")
+	flag.StringVar(&opts.defFile, "params", "", "read overrides of const and var from JSON or YAML `file`")
+	flag.Var(&opts.includes, "I", "search SMTL packages in `dir` (repeatable)")
+	flag.BoolVar(&opts.quiet, "q", false, "do not print version banner")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, cmdFmt, os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// 引数チェック
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, cmdFmt, os.Args[0])
-		return 1
+	if flag.NArg() < 1 || (opts.stats != "" && opts.stats != "text" && opts.stats != "json") {
+		flag.Usage()
+		return exitUsage
+	}
+
+	// メモリの上限はプロセス全体に適用される
+	if opts.memory > z3.MaxMemoryLimit {
+		fmt.Fprintf(os.Stderr, "memory limit must be %d megabytes at most\n", z3.MaxMemoryLimit)
+		return exitUsage
+	}
+	if opts.memory > 0 {
+		z3.SetMemoryLimit(opts.memory)
+	}
+	if opts.logic != "" {
+		if err := z3.CheckLogic(opts.logic); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	// パラメータファイルの定義は -D の定義より先に適用する
+	if opts.defFile != "" {
+		defines, err := loadDefines(opts.defFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		opts.defines = append(defines, opts.defines...)
+	}
+
+	// サブコマンドの実行。
+	// サブコマンドでない場合は SMTL ファイルとして解決する。
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	switch cmd {
+	case "solve":
+		return runSolve(&opts, args)
+	case "check":
+		return runCheck(&opts, args)
+	case "vet":
+		return runVet(&opts, args)
+	case "fmt":
+		return runFmt(&opts, args)
+	case "export":
+		return runExport(&opts, args)
+	case "gen":
+		return runGen(&opts, args)
+	case "batch":
+		opts.banner()
+		return runBatch(&opts, args)
+	case "test":
+		opts.banner()
+		return runTest(&opts, args)
+	case "repl":
+		opts.banner()
+		return runRepl(&opts)
+	case "lsp":
+		return runLsp(&opts, args)
+	case "serve":
+		return runServe(&opts, args)
+	case "version":
+		fmt.Println("smtrun", VERSION)
+		return exitSat
+	}
+	return runSolve(&opts, flag.Args())
+}
+
+// banner は -q が指定されていなければバージョンを表示する。
+// 標準出力に結果のソースコードなどを書き出すサブコマンドでは表示しない。
+func (opts *options) banner() {
+	if !opts.quiet {
+		fmt.Println("smtrun", VERSION)
+	}
+}
+
+// runSolve は solve コマンドを実行する関数。
+// 複数の SMTL ファイルは一つの問題としてまとめて解決する。"-" は標準入力を表す。
+func runSolve(opts *options, args []string) int {
+	// solve コマンドのオプションの処理
+	fset := flag.NewFlagSet("solve", flag.ContinueOnError)
+	outPath := fset.String("o", "", "write result into `file` (default stdout)")
+	vars := fset.String("var", "", "print only `names` of variables (comma separated)")
+	watch := fset.Bool("watch", false, "re-solve whenever SMTL files change and show changed variables")
+	poll := fset.Duration("poll", time.Second, "polling interval of -watch")
+	tmplPath := fset.String("template", "", "print model with text/template `file`")
+	fset.BoolVar(&opts.grid, "grid", false, "print arrays of variables as grids")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] solve [-o file] [-var x,y] [-template file | -grid] [-watch [-poll d]] file.smtl...\n", os.Args[0])
+		fset.PrintDefaults()
+	}
+	smtlFilePaths, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(smtlFilePaths) == 0 || (*tmplPath != "" && opts.grid) || (*watch && (*tmplPath != "" || opts.grid)) {
+		fset.Usage()
+		return exitUsage
+	}
+	if *vars != "" {
+		opts.vars = strings.Split(*vars, ",")
+	}
+	if *tmplPath != "" {
+		opts.tmpl, err = loadModelTemplate(*tmplPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	// 結果の出力先
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+	opts.banner()
+
+	// 更新されるたびに解決し直す
+	if *watch {
+		return runWatch(w, smtlFilePaths, opts, *poll)
+	}
+
+	// 統計情報の出力
+	stats := &runStats{File: strings.Join(smtlFilePaths, " "), Result: "error"}
+	if opts.stats != "" {
+		defer stats.print(os.Stderr, opts.stats)
+	}
+
+	code, err := solveFiles(w, smtlFilePaths, opts, stats)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return code
+}
+
+// runCheck は check コマンドを実行する関数。
+// SMTL ファイルをパースして z3 の AST を構築するが、解決はしない。
+func runCheck(opts *options, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] check file.smtl...\n", os.Args[0])
+		return exitUsage
+	}
+	solver, _, err := translateFiles(args, opts)
+	if solver != nil {
+		solver.Close()
+		solver.ctx.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
 	}
+	return exitSat
+}
 
-	fmt.Println("smtrun", VERSION)
+// loadSmtlFiles は SMTL ファイルをパースし、プラグマで指定されたパラメータと、
+// -D などで指定された値を適用したステートメントリストを取得する関数。
+// 位置は fset に記録する。
+func loadSmtlFiles(fset *token.FileSet, smtlFilePaths []string, opts *options) (stmts []ast.Stmt, fileParams []param, err error) {
+	for _, smtlFilePath := range smtlFilePaths {
+		var params []param
+		params, err = parseSmtlPragmas(smtlFilePath)
+		if err != nil {
+			return
+		}
+		fileParams = append(fileParams, params...)
+	}
+	if opts.confine {
+		// インポートは -I のディレクトリからのみ探す
+		var fileNodes []*ast.File
+		fileNodes, err = parseSmtlFileNodes(fset, smtlFilePaths)
+		if err == nil {
+			stmts, err = linkSmtlFiles(fset, fileNodes, opts.searchPath())
+		}
+	} else {
+		stmts, _, err = parseSmtlFileSet(fset, smtlFilePaths, opts.searchPath())
+	}
+	if err != nil {
+		return
+	}
 
-	smtlFilePath := os.Args[1]
+	// -D などで指定された値で const と var を上書きする
+	stmts, err = applyDefines(stmts, opts.defines)
+	return
+}
+
+// translateFiles は SMTL ファイルの制約関係を z3 の AST に変換する関数。
+// check 文や prove 文を含む場合も解決はしない。
+// 返されたソルバーとそのコンテクストは呼び出し側で Close する。
+func translateFiles(smtlFilePaths []string, opts *options) (solver *smtSolver, varTab map[string]*smtlVar, err error) {
+	fset := token.NewFileSet()
+	stmts, fileParams, err := loadSmtlFiles(fset, smtlFilePaths, opts)
+	if err != nil {
+		return
+	}
+	params := opts.configParams(fileParams)
+	ctx := newContext(params)
+	varTab = map[string]*smtlVar{}
+	solver = newSmtSolver(ctx, params, io.Discard)
+	solver.dryRun = true
+	solver.fset = fset
+	err = processStmts(ctx, solver, varTab, stmts)
+	return
+}
+
+// solveFiles は SMTL ファイルに記述された制約関係を解決し、結果を w に出力する関数。
+// 終了コードを返す。統計情報は stats に記録される。
+func solveFiles(w io.Writer, smtlFilePaths []string, opts *options, stats *runStats) (code int, err error) {
+	code = exitError
+
+	// SMTL ファイルのパース。
+	// プラグマで指定されたパラメータと、main 関数の中のステートメントリストを取得。
+	start := time.Now()
+	fileOpts := *opts
+	fileOpts.fset = token.NewFileSet()
+	opts = &fileOpts
+	stmts, fileParams, err := loadSmtlFiles(opts.fset, smtlFilePaths, opts)
+	if err != nil {
+		return
+	}
+	stats.Parse = time.Since(start)
+
+	// 複数の設定で並列に解決する
+	if opts.portfolio > 1 {
+		code, err = solvePortfolio(w, stmts, fileParams, opts, stats)
+		return
+	}
 
+	code, err = solveStmts(w, stmts, opts.configParams(fileParams), opts, stats)
+	return
+}
+
+// solveStmts はステートメントリストに記述された制約関係を、params を設定した
+// コンテクストで解決し、結果を w に出力する関数。終了コードを返す。
+func solveStmts(w io.Writer, stmts []ast.Stmt, params []param, opts *options, stats *runStats) (code int, err error) {
+	code = exitError
+	err = runStmts(w, stmts, params, opts, stats, func(solver *smtSolver, varTab map[string]*smtlVar) (err error) {
+		switch stats.Result {
+		case "checked":
+			// 解決不能な check 文や成り立たない prove 文があれば exitUnsat、
+			// 結果が不明なものがあれば exitUnknown とする。
+			switch {
+			case solver.failed > 0:
+				code = exitUnsat
+			case solver.unknown > 0:
+				code = exitUnknown
+			default:
+				code = exitSat
+			}
+		case "unsat":
+			fmt.Fprintln(w, "Unsolveable")
+			code = exitUnsat
+		case "unknown":
+			fmt.Fprintf(w, "Unknown (%s)\n", solver.reason)
+			code = exitUnknown
+		default:
+			// 結果を表示
+			if err = printModel(w, varTab, solver); err == nil {
+				code = exitSat
+			}
+		}
+		return
+	})
+	return
+}
+
+// runStmts はステートメントリストに記述された制約関係を、params を設定した
+// コンテクストで解決する関数。solveStmts と solveStmtsResult が共通に使用する。
+// check 文および prove 文の結果は w に出力され、それらがない場合は Check で解決する。
+// 解決結果 (sat、unsat、unknown、checked) は stats.Result に記録し、
+// 結果の出力は、コンテクストとソルバーが有効な間に report で行う。
+func runStmts(w io.Writer, stmts []ast.Stmt, params []param, opts *options, stats *runStats, report func(solver *smtSolver, varTab map[string]*smtlVar) error) (err error) {
 	// コンテクストオブジェクトの作成
-	config := z3.NewConfig()
-	ctx := z3.NewContext(config)
-	config.Close()
+	ctx := newContext(params)
 	defer ctx.Close()
+	defer interruptOn(ctx, opts.stop)()
 
 	// 変数テーブル初期化
-	varTab := map[string]*z3.AST{}
+	varTab := map[string]*smtlVar{}
 
-	// SMTファイルの処理
-	solver, err := processSmtlFile(ctx, varTab, smtlFilePath)
+	// 各ステートメントを処理し、変数と制約関係を登録
+	start := time.Now()
+	solver := newSmtSolver(ctx, params, w)
+	solver.vars = opts.vars
+	solver.timeout = opts.timeout
+	solver.deadline = opts.deadline
+	solver.maxVars = opts.maxVars
+	solver.fset = opts.fset
+	solver.tmpl = opts.tmpl
+	solver.grid = opts.grid
+	defer solver.Close()
+	err = processStmts(ctx, solver, varTab, stmts)
+	stats.Translate = time.Since(start)
+	for _, v := range varTab {
+		if !v.isConst && v.dims == nil {
+			stats.Vars++
+		}
+	}
+	stats.Asserts = solver.NumAsserts()
+	stats.Softs = len(solver.Softs())
+	stats.Solver = solver.stats
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 2
+		return
 	}
-	defer solver.Close()
 
-	// 解決可能かどうかをチェック
-	if v := solver.Check(); v != z3.True {
-		fmt.Println("Unsolveable")
-		return 3
+	// -var で指定された変数が宣言されているか確認する
+	for _, name := range opts.vars {
+		if v := varTab[name]; v == nil || v.isConst {
+			err = fmt.Errorf("%s is unknown variable", name)
+			return
+		}
+	}
+
+	// check 文や prove 文で結果を出力済みの場合は解決しない
+	if solver.checks > 0 {
+		stats.Result = "checked"
+		err = report(solver, varTab)
+		return
 	}
 
-	// 結果となるモデルを取得
-	m := solver.Model()
-	assignments := m.Assignments()
-	m.Close()
+	// 解決可能かどうかをチェック
+	start = time.Now()
+	r := solver.Check()
+	stats.Check = time.Since(start)
+	stats.Solver = solver.stats
+	switch r {
+	case z3.False:
+		stats.Result = "unsat"
+	case z3.Undef:
+		stats.Result = "unknown"
+	default:
+		stats.Result = "sat"
+	}
+	err = report(solver, varTab)
+	return
+}
 
-	// 変数名を取得
-	var names []string
-	for name := range varTab {
-		names = append(names, name)
+// modelVarNames はモデルに値を表示する変数と配列の名前を順に並べて返す関数。
+// -var が指定された場合はその変数のみを表示する。配列の要素は含まない。
+func modelVarNames(varTab map[string]*smtlVar, solver *smtSolver) (names []string) {
+	for name, v := range varTab {
+		// 定数は表示しない
+		if !v.isConst && !v.isElem {
+			names = append(names, name)
+		}
+	}
+	if len(solver.vars) > 0 {
+		names = append([]string{}, solver.vars...)
 	}
 	sort.Strings(names)
+	return
+}
 
-	// 制約関係を満たす変数の値を表示
-	for _, name := range names {
-		fmt.Printf("%s = %s\n", name, assignments[name])
+// modelNames はモデルに値を表示する変数の名前を順に並べて返す関数。
+// 配列は c[0][0], c[0][1], ... の順に要素の名前に展開する。
+func modelNames(varTab map[string]*smtlVar, solver *smtSolver) (names []string) {
+	for _, name := range modelVarNames(varTab, solver) {
+		if v := varTab[name]; v != nil && v.dims != nil {
+			names = append(names, v.elems...)
+		} else {
+			names = append(names, name)
+		}
 	}
+	return
+}
 
-	return 0
+// printModel は制約関係を満たす変数の値と、違反したソフト制約を表示する関数。
+// -template が指定された場合はテンプレートで、-grid が指定された場合は
+// 配列を格子状に並べて表示する。
+func printModel(w io.Writer, varTab map[string]*smtlVar, solver *smtSolver) (err error) {
+	switch {
+	case solver.tmpl != nil:
+		// 違反したソフト制約もテンプレートで表示する
+		err = solver.tmpl.Execute(w, newModelData(varTab, solver))
+		return
+	case solver.grid:
+		printGridModel(w, newModelData(varTab, solver))
+	default:
+		// 制約関係を満たす変数の値を表示
+		assignments := solver.Model().Assignments()
+		for _, name := range modelNames(varTab, solver) {
+			fmt.Fprintf(w, "%s = %s\n", name, assignments[name])
+		}
+	}
+
+	// 違反したソフト制約とペナルティの総和を表示
+	if len(solver.Softs()) > 0 {
+		penalty := 0
+		for _, soft := range solver.Violated() {
+			if soft.group == "" {
+				fmt.Fprintf(w, "violated: %s (weight %d)\n", soft.text, soft.weight)
+			} else {
+				fmt.Fprintf(w, "violated: %s (weight %d, group %q)\n", soft.text, soft.weight, soft.group)
+			}
+			penalty += soft.weight
+		}
+		if solver.optimal {
+			fmt.Fprintf(w, "penalty = %d\n", penalty)
+		} else {
+			fmt.Fprintf(w, "penalty = %d (not proven minimal)\n", penalty)
+		}
+	}
+	return
 }
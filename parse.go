@@ -7,41 +7,300 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
 const (
 	smtlPkgName = "smtl"
+
+	// プラグマとして扱うコメントの接頭辞
+	pragmaPrefix = "//smtl:"
+
+	// 標準入力から読み込むことを表すファイル名と、エラーの位置に示す名前
+	stdinPath = "-"
+	stdinName = "<stdin>"
 )
 
-// parseSmtlFile は SMTL ファイルをパースし、main 関数の中のステートメントリストを取得する関数。
-func parseSmtlFile(smtFilePath string) (stmts []ast.Stmt, err error) {
+// 標準入力から読み込んだ SMTL
+var (
+	stdinOnce sync.Once
+	stdinSrc  []byte
+	stdinErr  error
+)
 
-	// golang の構文としてパースし、ファイルノードを取得
-	var fileNode *ast.File
-	fset := token.NewFileSet()
-	fileNode, err = parser.ParseFile(fset, smtFilePath, nil, 0)
+// エディタで編集中の SMTL ファイルの内容 (lsp コマンドで使用) と、
+// HTTP で受け取った SMTL (serve コマンドで使用)。
+// ファイル名が登録されている場合は、ファイルの代わりにこの内容をパースする。
+var (
+	srcOverlayMu sync.RWMutex
+	srcOverlay   = map[string][]byte{}
+)
+
+// setSrcOverlay はファイル名に対応する内容を登録する関数。
+// src が nil の場合は登録を取り消す。
+func setSrcOverlay(smtFilePath string, src []byte) {
+	srcOverlayMu.Lock()
+	defer srcOverlayMu.Unlock()
+	if src == nil {
+		delete(srcOverlay, smtFilePath)
+	} else {
+		srcOverlay[smtFilePath] = src
+	}
+}
+
+// lookupSrcOverlay はファイル名に対応する登録された内容を返す関数。
+func lookupSrcOverlay(smtFilePath string) (src []byte, ok bool) {
+	srcOverlayMu.RLock()
+	defer srcOverlayMu.RUnlock()
+	src, ok = srcOverlay[smtFilePath]
+	return
+}
+
+// parseSmtlFiles は SMTL ファイルをパースし、main 関数の中のステートメントリストを取得する関数。
+// 複数のファイルを指定した場合は一つの問題としてまとめ、各ファイルのステートメントを順に並べる。
+// インポートしたパッケージは SMTL ファイルのあるディレクトリと searchPath から探し、
+// その宣言をステートメントリストの前に加える。
+func parseSmtlFiles(smtFilePaths []string, searchPath []string) (stmts []ast.Stmt, err error) {
+	stmts, _, err = parseSmtlFileSet(token.NewFileSet(), smtFilePaths, searchPath)
+	return
+}
+
+// parseSmtlFileSet は parseSmtlFiles と同様に SMTL ファイルをパースする関数。
+// 位置を fset に記録し、各ファイルのファイルノードも返す。
+func parseSmtlFileSet(fset *token.FileSet, smtFilePaths []string, searchPath []string) (stmts []ast.Stmt, fileNodes []*ast.File, err error) {
+	fileNodes, err = parseSmtlFileNodes(fset, smtFilePaths)
 	if err != nil {
 		return
 	}
 
-	//ast.Print(fset, fileNode)
-	//ast.Print(fset, fileNode.Decls)
+	var dirs []string
+	for _, smtFilePath := range smtFilePaths {
+		dirs = append(dirs, filepath.Dir(smtFilePath))
+	}
+	searchPath = append(dirs, searchPath...)
+	stmts, err = linkSmtlFiles(fset, fileNodes, searchPath)
+	return
+}
+
+// parseSmtlFileNodes は SMTL ファイルを golang の構文としてパースし、
+// パッケージ名が smtl であることを確かめたファイルノードを返す関数。
+func parseSmtlFileNodes(fset *token.FileSet, smtFilePaths []string) (fileNodes []*ast.File, err error) {
+
+	// golang の構文としてパースし、ファイルノードを取得
+	for _, smtFilePath := range smtFilePaths {
+		var fileNode *ast.File
+		fileNode, err = parseSmtlSource(fset, smtFilePath, 0)
+		if err != nil {
+			return
+		}
+
+		//ast.Print(fset, fileNode)
+		//ast.Print(fset, fileNode.Decls)
+
+		// パッケージ名が "smtl" かどうかチェックする
+		if fileNode.Name.Name != smtlPkgName {
+			err = fmt.Errorf("%s is not supported package", fileNode.Name.Name)
+			return
+		}
+		fileNodes = append(fileNodes, fileNode)
+	}
+	return
+}
+
+// parseSmtlSource は SMTL ファイルを golang の構文としてパースする関数。
+// ファイル名が "-" の場合は標準入力から読み込む。編集中の内容が登録されている場合はそれを使用する。
+// 標準入力は一度だけ読み込み、その内容をプラグマや注釈のパースでも使用する。
+func parseSmtlSource(fset *token.FileSet, smtFilePath string, mode parser.Mode) (fileNode *ast.File, err error) {
+	if src, ok := lookupSrcOverlay(smtFilePath); ok {
+		fileNode, err = parser.ParseFile(fset, smtFilePath, src, mode)
+		return
+	}
+	if smtFilePath != stdinPath {
+		fileNode, err = parser.ParseFile(fset, smtFilePath, nil, mode)
+		return
+	}
+	stdinOnce.Do(func() {
+		stdinSrc, stdinErr = io.ReadAll(os.Stdin)
+	})
+	if stdinErr != nil {
+		err = stdinErr
+		return
+	}
+	fileNode, err = parser.ParseFile(fset, stdinName, stdinSrc, mode)
+	return
+}
 
-	// パッケージ名が "smtl" かどうかチェックする
-	if fileNode.Name.Name != smtlPkgName {
-		err = fmt.Errorf("%s is not supported package", fileNode.Name.Name)
+// parseSmtlStmts は main 関数の中身として SMTL のステートメントの並びをパースし、
+// ステートメントリストを取得する関数。
+func parseSmtlStmts(src string) (stmts []ast.Stmt, err error) {
+	var fileNode *ast.File
+	fset := token.NewFileSet()
+	src = "package " + smtlPkgName + "; func main() {\n" + src + "\n}"
+	fileNode, err = parser.ParseFile(fset, "", src, 0)
+	if err != nil {
 		return
 	}
+	stmts = mainStmts(fileNode)
+	return
+}
 
+// mainStmts は main 関数のステートメントリストを取得する関数。
+func mainStmts(fileNode *ast.File) (stmts []ast.Stmt) {
 	// ファイルノードのトップレベルの「宣言」の中から main 関数を
 	// 見つけ出し、そのステートメントリストを抽出する。
 	for _, n := range fileNode.Decls {
 		// 関数宣言のうちその名前が "main" のものをみつける
 		funcDecl, ok := n.(*ast.FuncDecl)
-		if ok && funcDecl.Name.Name == "main" {
+		if ok && funcDecl.Name.Name == "main" && funcDecl.Body != nil {
 			stmts = funcDecl.Body.List
 			break
 		}
 	}
 	return
 }
+
+// parseSmtlPragmas は SMTL ファイルのプラグマのコメントをパースし、
+// "//smtl:option key=value" で指定されたパラメータと、
+// "//smtl:tactic t1,t2,..." で指定されたタクティクのリストを取得する関数。
+func parseSmtlPragmas(smtFilePath string) (params []param, err error) {
+	var fileNode *ast.File
+	fset := token.NewFileSet()
+	fileNode, err = parseSmtlSource(fset, smtFilePath, parser.ParseComments)
+	if err != nil {
+		return
+	}
+
+	for _, cg := range fileNode.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, pragmaPrefix) {
+				continue
+			}
+			kind, arg := strings.TrimPrefix(c.Text, pragmaPrefix), ""
+			if i := strings.IndexAny(kind, " \t"); i >= 0 {
+				kind, arg = kind[:i], strings.TrimSpace(kind[i+1:])
+			}
+
+			switch kind {
+			case "option":
+				var p param
+				p, err = parseParam(arg)
+				if err == nil {
+					params = append(params, p)
+				}
+			case "tactic":
+				var p param
+				p, err = parseTactic(arg)
+				if err == nil {
+					params = append(params, p)
+				}
+			default:
+				err = fmt.Errorf("%s is unknown pragma", kind)
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %s", fset.Position(c.Pos()), err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// want は SMTL ファイルに "// want: sat" や "// want x == 13" の形式で
+// 記述された、期待する解決結果の注釈。
+// check 文および prove 文と同じ行の "// want: valid" などの注釈は、
+// その文の結果の注釈となる。
+type want struct {
+	pos    token.Position
+	result string   // "sat"、"unsat"、"unknown"、"error" のいずれか。式の注釈の場合は空
+	errMsg string   // "// want: error msg" の場合に、エラーメッセージに含まれるべき文字列
+	expr   ast.Expr // モデルにおいて真となるべき式
+	call   int      // check 文および prove 文の結果の注釈の場合に、文の番号 (1 から)。それ以外は 0
+}
+
+// parseSmtlWants は SMTL ファイルのコメントの中から、期待する解決結果の注釈を取得する関数。
+func parseSmtlWants(smtFilePath string) (wants []want, err error) {
+	var fileNode *ast.File
+	fset := token.NewFileSet()
+	fileNode, err = parseSmtlSource(fset, smtFilePath, parser.ParseComments)
+	if err != nil {
+		return
+	}
+
+	// check 文および prove 文の行と、その文の番号および名前
+	type call struct {
+		n    int
+		name string
+	}
+	calls := map[int]call{}
+	ast.Inspect(fileNode, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		if c, ok := stmt.X.(*ast.CallExpr); ok {
+			if id, ok := c.Fun.(*ast.Ident); ok && (id.Name == "check" || id.Name == "prove") {
+				calls[fset.Position(c.Pos()).Line] = call{n: len(calls) + 1, name: id.Name}
+			}
+		}
+		return true
+	})
+
+	cmap := ast.NewCommentMap(fset, fileNode, fileNode.Comments)
+	for _, cg := range cmap.Comments() {
+		for _, c := range cg.List {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if !strings.HasPrefix(text, "want") {
+				continue
+			}
+			w := want{pos: fset.Position(c.Pos())}
+			text = strings.TrimPrefix(text, "want")
+			if strings.HasPrefix(text, ":") {
+				// 解決結果の注釈
+				w.result = strings.TrimSpace(strings.TrimPrefix(text, ":"))
+				if strings.HasPrefix(w.result, "error") {
+					w.result, w.errMsg = "error", strings.TrimSpace(strings.TrimPrefix(w.result, "error"))
+				}
+				if c, ok := calls[w.pos.Line]; ok {
+					// check 文および prove 文の結果の注釈
+					w.call = c.n
+					if !validCallResult(c.name, w.result) {
+						err = fmt.Errorf("%s: %s is unknown result of %s", w.pos, w.result, c.name)
+						return
+					}
+				} else if w.result != "sat" && w.result != "unsat" && w.result != "unknown" && w.result != "error" {
+					err = fmt.Errorf("%s: %s is unknown result", w.pos, w.result)
+					return
+				}
+			} else if strings.HasPrefix(text, " ") {
+				// 式の注釈
+				w.expr, err = parser.ParseExpr(text)
+				if err != nil {
+					err = fmt.Errorf("%s: %s", w.pos, err)
+					return
+				}
+			} else {
+				continue
+			}
+			wants = append(wants, w)
+		}
+	}
+	return
+}
+
+// validCallResult は check 文 (sat、unsat、unknown) および prove 文 (valid、invalid、unknown) の
+// 結果として正しいかどうかを判定する関数。
+func validCallResult(name, result string) bool {
+	switch result {
+	case "unknown":
+		return true
+	case "sat", "unsat":
+		return name == "check"
+	case "valid", "invalid":
+		return name == "prove"
+	}
+	return false
+}
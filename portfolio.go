@@ -0,0 +1,163 @@
+// ポートフォリオによる解決
+// 同じステートメントリストから設定の異なる複数のコンテクストを作成して並列に解決し、
+// 最初に得られた確定的な結果を採用する。
+// 設定の違いはソルバーの乱数の種、連続する assert 文の順序、
+// auto_config パラメータおよびソルバーを作るタクティクによって作る。
+// 確定的な結果が得られた時点で、他の設定の解決は Z3_interrupt で中断する。
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+// portfolioTactics は設定ごとに順に割り当てるタクティクの並び。
+// 空の場合はタクティクを指定しない既定のソルバーとする。
+var portfolioTactics = []string{
+	"",
+	"simplify,propagate-values,ctx-simplify,smt",
+	"simplify,solve-eqs,elim-uncnstr,smt",
+	"qflia",
+}
+
+// portfolioResult は一つの設定での解決結果を保持する構造体。
+type portfolioResult struct {
+	code  int
+	err   error
+	out   bytes.Buffer
+	stats runStats
+}
+
+// solvePortfolio はステートメントリストに記述された制約関係を opts.portfolio 個の
+// 設定で並列に解決し、最初に得られた確定的な結果を w に出力する関数。
+func solvePortfolio(w io.Writer, stmts []ast.Stmt, fileParams []param, opts *options, stats *runStats) (code int, err error) {
+	// 各設定で並列に解決する。
+	// 採用する結果が決まったら stop を閉じて他の設定の解決を中断する。
+	// 呼び出し側の opts.stop が閉じられた場合も同様に中断する。
+	stop := make(chan struct{})
+	var once sync.Once
+	cancel := func() { once.Do(func() { close(stop) }) }
+	if opts.stop != nil {
+		go func() {
+			select {
+			case <-opts.stop:
+				cancel()
+			case <-stop:
+			}
+		}()
+	}
+	workerOpts := *opts
+	workerOpts.stop = stop
+	useTactics := !hasSolverKind(opts.configParams(fileParams))
+	results := make(chan *portfolioResult, opts.portfolio)
+	for i := 0; i < opts.portfolio; i++ {
+		// i 番目の設定: i を乱数の種とし、i を種として assert 文の順序を入れ替え、
+		// i が奇数の場合は auto_config を無効にする。
+		// ロジックとタクティクが指定されていなければ portfolioTactics を順に使用する
+		workerStmts := stmts
+		if i > 0 {
+			workerStmts = shuffleAsserts(stmts, rand.New(rand.NewSource(int64(i))))
+		}
+		seed := strconv.Itoa(i)
+		workerParams := append([]param{
+			{key: "auto_config", value: "true"},
+			{key: "smt.random_seed", value: seed, target: targetSolver},
+			{key: "sat.random_seed", value: seed, target: targetSolver},
+		}, fileParams...)
+		if i%2 == 1 {
+			workerParams[0].value = "false"
+		}
+		if tactic := portfolioTactics[i%len(portfolioTactics)]; useTactics && tactic != "" {
+			// 使用している Z3 にないタクティクの場合は既定のソルバーとする
+			if p, e := parseTactic(tactic); e == nil {
+				workerParams = append(workerParams, p)
+			}
+		}
+		workerParams = workerOpts.configParams(workerParams)
+
+		go func() {
+			r := &portfolioResult{}
+			r.stats = *stats
+			r.code, r.err = solveStmts(&r.out, workerStmts, workerParams, &workerOpts, &r.stats)
+			results <- r
+		}()
+	}
+
+	// 最初に得られた確定的な結果を採用する。
+	// 全ての結果が不明の場合は最初に得られたものを採用する。
+	// 中断した設定の終了を待ち、そのコンテクストが解放されてから返る。
+	var first *portfolioResult
+	n := 0
+	for n < opts.portfolio {
+		r := <-results
+		n++
+		if first == nil {
+			first = r
+		}
+		if r.code != exitUnknown {
+			first = r
+			break
+		}
+	}
+	cancel()
+	for ; n < opts.portfolio; n++ {
+		<-results
+	}
+
+	w.Write(first.out.Bytes())
+	*stats = first.stats
+	return first.code, first.err
+}
+
+// hasSolverKind はパラメータにロジックもしくはタクティクが含まれるかどうかを判定する関数。
+func hasSolverKind(params []param) bool {
+	for _, p := range params {
+		if p.target == targetLogic || p.target == targetTactic {
+			return true
+		}
+	}
+	return false
+}
+
+// shuffleAsserts はステートメントリストのうち、連続する assert 文の順序を
+// rng によって入れ替えたリストを返す関数。
+// 連続する assert 文の順序は解決結果に影響しないが、ソルバーの探索には影響する。
+func shuffleAsserts(stmts []ast.Stmt, rng *rand.Rand) []ast.Stmt {
+	shuffled := append([]ast.Stmt{}, stmts...)
+	for i := 0; i < len(shuffled); {
+		// assert 文が連続する範囲 [i, j) を探す
+		j := i
+		for j < len(shuffled) && isAssertStmt(shuffled[j]) {
+			j++
+		}
+		if j == i {
+			i++
+			continue
+		}
+		run := shuffled[i:j]
+		rng.Shuffle(len(run), func(a, b int) {
+			run[a], run[b] = run[b], run[a]
+		})
+		i = j
+	}
+	return shuffled
+}
+
+// isAssertStmt はステートメントが assert 文かどうかを判定する関数。
+func isAssertStmt(stmt ast.Stmt) bool {
+	exprStmt, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	ce, ok := exprStmt.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	fun, ok := ce.Fun.(*ast.Ident)
+	return ok && fun.Name == "assert"
+}
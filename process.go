@@ -7,23 +7,39 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
+	"go/types"
+	"math"
 	"strconv"
+	"strings"
 
-	"github.com/mitchellh/go-z3"
+	"github.com/bunji2/smtrun/z3"
 )
 
-// processSmtlFile は SMTL ファイルを処理する関数。
-func processSmtlFile(ctx *z3.Context, varTab map[string]*z3.AST, smtFilePath string) (s *z3.Solver, err error) {
-	// SMT ファイルのパース。main 関数の中のステートメントリストを取得。
-	var stmts []ast.Stmt
-	stmts, err = parseSmtlFile(smtFilePath)
-	if err != nil {
-		return
-	}
+// smtlVar は SMTL の変数を表す構造体。
+type smtlVar struct {
+	x       *z3.AST        // 変数に対応する z3 の AST (配列の場合は nil)
+	sort    string         // 変数の型 ("int" もしくは "bool"、配列の場合は要素の型)
+	isConst bool           // const で宣言された定数か
+	val     constant.Value // 定数の値 (定数式でない場合は nil)
+	dims    []int          // 配列の各次元の長さ (配列でない場合は nil)
+	elems   []string       // 配列の要素の変数の名前 (c[0][0], c[0][1], ... の順)
+	isElem  bool           // 配列の要素か
+	pos     token.Pos      // 宣言された位置 (配列の要素の場合は配列の宣言の位置)
+}
 
-	s = ctx.NewSolver()
+// typeName は変数の型を SMTL の記法で返す。配列の場合は [3][3]int のようになる。
+func (v *smtlVar) typeName() string {
+	var b strings.Builder
+	for _, n := range v.dims {
+		fmt.Fprintf(&b, "[%d]", n)
+	}
+	return b.String() + v.sort
+}
 
+// processStmts はステートメントリストを処理する関数。
+func processStmts(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, stmts []ast.Stmt) (err error) {
 	// 各ステートメントを処理
 	for _, stmt := range stmts {
 		err = processStmt(ctx, s, varTab, stmt)
@@ -31,12 +47,11 @@ func processSmtlFile(ctx *z3.Context, varTab map[string]*z3.AST, smtFilePath str
 			break
 		}
 	}
-
 	return
 }
 
 // processStmt はステートメントを処理する関数。
-func processStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, stmt ast.Stmt) (err error) {
+func processStmt(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, stmt ast.Stmt) (err error) {
 	switch stmt.(type) {
 	case *ast.DeclStmt: // 宣言に関するステートメント
 		//fmt.Println("DeclStmt!")
@@ -44,6 +59,8 @@ func processStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, stmt
 	case *ast.ExprStmt: // 式に関するステートメント
 		//fmt.Println("ExprStmt!")
 		err = processExprStmt(ctx, s, varTab, stmt.(*ast.ExprStmt))
+	case *ast.BlockStmt: // ブロック
+		err = processBlockStmt(ctx, s, varTab, stmt.(*ast.BlockStmt))
 	default:
 		// その他のステートメントはエラー
 		err = fmt.Errorf("not supported Stmt")
@@ -51,45 +68,84 @@ func processStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, stmt
 	return
 }
 
+// processBlockStmt はブロックを処理する関数。
+// ブロックの中で宣言された変数と制約は、ブロックの外では破棄される。
+func processBlockStmt(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, block *ast.BlockStmt) (err error) {
+	// ブロック用の変数テーブル
+	blockVarTab := map[string]*smtlVar{}
+	for name, x := range varTab {
+		blockVarTab[name] = x
+	}
+
+	s.Push()
+	err = processStmts(ctx, s, blockVarTab, block.List)
+	s.Pop()
+	return
+}
+
 // processDeclStmt は宣言ステートメントを処理する関数。
-func processDeclStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, decl *ast.DeclStmt) (err error) {
+func processDeclStmt(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, decl *ast.DeclStmt) (err error) {
 	//fmt.Println("DeclStmt!")
 
-	// 変数宣言 (var x TYPE) ならば変数を登録する
+	// 変数宣言 (var x TYPE) ならば変数を、定数宣言 (const n = VALUE) ならば定数を登録する。
+	// var ( ... ) のようにまとめて宣言された場合は、全ての宣言を順に処理する。
 	gd, ok := decl.Decl.(*ast.GenDecl)
-	if ok && gd.Tok == token.VAR {
-		err = processVarSpec(ctx, varTab, gd.Specs[0].(*ast.ValueSpec))
-	} else {
+	if !ok || (gd.Tok != token.VAR && gd.Tok != token.CONST) {
 		err = fmt.Errorf("not supported Tok of DeclStmt")
+		return
+	}
+	for _, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if gd.Tok == token.VAR {
+			err = processVarSpec(ctx, s, varTab, vs)
+		} else {
+			err = processConstSpec(ctx, s, varTab, vs)
+		}
+		if err != nil {
+			break
+		}
 	}
 	return
 }
 
 // processVarSpec は変数宣言を処理する関数。
 // 変数は varTab に登録される。
-func processVarSpec(ctx *z3.Context, varTab map[string]*z3.AST, vs *ast.ValueSpec) (err error) {
+// 初期値 (var x int = 5) がある場合は、変数と初期値が等しいという制約を追加する。
+func processVarSpec(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, vs *ast.ValueSpec) (err error) {
+
+	// 初期値の確認
+	var values []*z3.AST
+	var valueSorts []string
+	values, valueSorts, err = processSpecValues(ctx, varTab, vs)
+	if err != nil {
+		return
+	}
 
 	// 変数の型の確認
 	var sort *z3.Sort
+	var sortName string
 
 	switch vs.Type.(type) {
 	case *ast.Ident:
 		id := vs.Type.(*ast.Ident)
-		switch id.Name {
-		case "int":
-			sort = ctx.IntSort()
-		case "bool":
-			sort = ctx.BoolSort()
+		sortName = id.Name
 
-			// 対応する型を増やす場合はここに挿入
-
-		default:
-			// 非対応の型
-			err = fmt.Errorf("type %s is not supported", id.Name)
+	case nil:
+		// 型が省略された場合は初期値の型とする (var x = 5)
+		if len(values) == 0 {
+			err = fmt.Errorf("var %s must have type or value", vs.Names[0].Name)
+			return
 		}
+		sortName = valueSorts[0]
 
 	case *ast.ArrayType:
-		err = fmt.Errorf("ArrayType of VarSpec is not supported")
+		// 配列 (var c [3][3]int) は要素ごとの変数として登録する
+		if len(values) > 0 {
+			err = fmt.Errorf("array var %s cannot have value", vs.Names[0].Name)
+			return
+		}
+		err = processArraySpec(ctx, s, varTab, vs)
+		return
 
 	default:
 		err = fmt.Errorf("not supported Type of ValueSpec")
@@ -99,44 +155,238 @@ func processVarSpec(ctx *z3.Context, varTab map[string]*z3.AST, vs *ast.ValueSpe
 		return
 	}
 
+	switch sortName {
+	case sortInt:
+		sort = ctx.IntSort()
+	case sortBool:
+		sort = ctx.BoolSort()
+
+		// 対応する型を増やす場合はここに挿入
+
+	default:
+		// 非対応の型
+		err = fmt.Errorf("type %s is not supported", sortName)
+		return
+	}
+
+	if err = s.declareVars(vs.Names[0], len(vs.Names)); err != nil {
+		return
+	}
+
 	// 各変数の処理
-	for _, name := range vs.Names {
+	for i, name := range vs.Names {
 		// 変数名の重複は禁止
-		if _, ok := varTab[name.Name]; ok {
-			err = fmt.Errorf("var %s is already declared", name.Name)
+		if err = s.checkRedeclared(varTab, "var", name); err != nil {
+			break
+		}
+		x := ctx.Const(ctx.Symbol(name.Name), sort)
+		varTab[name.Name] = &smtlVar{x: x, sort: sortName, pos: name.Pos()}
+
+		// 初期値は等式の制約とする
+		if len(values) > 0 {
+			if valueSorts[i] != sortName {
+				err = fmt.Errorf("cannot use %s (%s) as %s value of var %s", types.ExprString(vs.Values[i]), valueSorts[i], sortName, name.Name)
+				break
+			}
+			s.Assert(x.Eq(values[i]))
+		}
+	}
+
+	return
+}
+
+// maxArrayElems は一つの配列の要素の数の上限。
+// 要素ごとに変数を作成するため、[100000][100000]int のような配列でメモリを使い果たさないようにする。
+const maxArrayElems = 1000000
+
+// processArraySpec は配列の変数宣言を処理する関数。
+// 配列の各要素は c[0][1] のような名前の変数として varTab に登録される。
+// 配列の長さには整数リテラルもしくは int の定数式を使用でき、要素の数は maxArrayElems までとする。
+func processArraySpec(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, vs *ast.ValueSpec) (err error) {
+	// 各次元の長さと要素の型。要素の数は maxArrayElems までとする
+	var dims []int
+	size := 1
+	typ := vs.Type
+	for {
+		at, ok := typ.(*ast.ArrayType)
+		if !ok {
+			break
+		}
+		if at.Len == nil {
+			err = fmt.Errorf("slice type %s is not supported", types.ExprString(vs.Type))
+			return
+		}
+		var n int
+		n, err = constInt(varTab, at.Len)
+		if err != nil {
+			return
+		}
+		if n <= 0 {
+			err = fmt.Errorf("length of array %s must be positive", types.ExprString(vs.Type))
+			return
+		}
+		if n > maxArrayElems/size {
+			err = s.errorf(vs.Type.Pos(), "array %s has more than %d elements", types.ExprString(vs.Type), maxArrayElems)
+			return
+		}
+		size *= n
+		dims = append(dims, n)
+		typ = at.Elt
+	}
+	id, ok := typ.(*ast.Ident)
+	if !ok || (id.Name != sortInt && id.Name != sortBool) {
+		err = fmt.Errorf("type %s is not supported", types.ExprString(vs.Type))
+		return
+	}
+	sort := ctx.IntSort()
+	if id.Name == sortBool {
+		sort = ctx.BoolSort()
+	}
+
+	// 各配列の処理
+	for _, name := range vs.Names {
+		if err = s.checkRedeclared(varTab, "var", name); err != nil {
+			break
+		}
+		if err = s.declareVars(name, size); err != nil {
 			break
 		}
-		varTab[name.Name] = ctx.Const(ctx.Symbol(name.Name), sort)
+		v := &smtlVar{sort: id.Name, dims: dims, pos: name.Pos()}
+		for _, elem := range arrayElemNames(name.Name, dims) {
+			x := ctx.Const(ctx.Symbol(elem), sort)
+			varTab[elem] = &smtlVar{x: x, sort: id.Name, isElem: true, pos: name.Pos()}
+			v.elems = append(v.elems, elem)
+		}
+		varTab[name.Name] = v
 	}
+	return
+}
 
+// arrayElemNames は配列の要素の名前を c[0][0], c[0][1], ... の順に返す関数。
+func arrayElemNames(name string, dims []int) (names []string) {
+	names = []string{name}
+	for _, n := range dims {
+		var next []string
+		for _, prefix := range names {
+			for i := 0; i < n; i++ {
+				next = append(next, fmt.Sprintf("%s[%d]", prefix, i))
+			}
+		}
+		names = next
+	}
+	return
+}
+
+// processConstSpec は定数宣言を処理する関数。
+// 定数は値の AST を持つ変数として varTab に登録され、モデルには表示されない。
+// 定数の値には整数リテラル、true、false およびそれらと他の定数からなる式を使用できる。
+func processConstSpec(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, vs *ast.ValueSpec) (err error) {
+
+	// 値の確認
+	if len(vs.Values) == 0 {
+		err = fmt.Errorf("const %s must have value", vs.Names[0].Name)
+		return
+	}
+	for _, value := range vs.Values {
+		if err = checkConstExpr(varTab, value); err != nil {
+			return
+		}
+	}
+	var values []*z3.AST
+	var valueSorts []string
+	values, valueSorts, err = processSpecValues(ctx, varTab, vs)
+	if err != nil {
+		return
+	}
+
+	// 型が指定された場合は値の型と一致するか確認する (const n int = 9)
+	var sortName string
+	if vs.Type != nil {
+		id, ok := vs.Type.(*ast.Ident)
+		if !ok || (id.Name != sortInt && id.Name != sortBool) {
+			err = fmt.Errorf("type %s is not supported", types.ExprString(vs.Type))
+			return
+		}
+		sortName = id.Name
+	}
+
+	// 各定数の処理
+	for i, name := range vs.Names {
+		if err = s.checkRedeclared(varTab, "const", name); err != nil {
+			break
+		}
+		if sortName != "" && valueSorts[i] != sortName {
+			err = fmt.Errorf("cannot use %s (%s) as %s value of const %s", types.ExprString(vs.Values[i]), valueSorts[i], sortName, name.Name)
+			break
+		}
+		varTab[name.Name] = &smtlVar{x: values[i], sort: valueSorts[i], isConst: true, val: constValue(varTab, vs.Values[i]), pos: name.Pos()}
+	}
+
+	return
+}
+
+// processSpecValues は宣言の初期値を処理し、その AST と型のリストを返す関数。
+// 初期値がある場合、その数は宣言される名前の数と一致しなければならない。
+func processSpecValues(ctx *z3.Context, varTab map[string]*smtlVar, vs *ast.ValueSpec) (values []*z3.AST, sorts []string, err error) {
+	if len(vs.Values) == 0 {
+		return
+	}
+	if len(vs.Values) != len(vs.Names) {
+		err = fmt.Errorf("%s: %d names but %d values", vs.Names[0].Name, len(vs.Names), len(vs.Values))
+		return
+	}
+	for _, value := range vs.Values {
+		var x *z3.AST
+		var sort string
+		sort, err = exprSort(varTab, value)
+		if err != nil {
+			return
+		}
+		x, err = processExpr(ctx, varTab, value)
+		if err != nil {
+			return
+		}
+		values = append(values, x)
+		sorts = append(sorts, sort)
+	}
 	return
 }
 
 // processExprStmt は式のステートメントを処理する関数。
-func processExprStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, exprStmt *ast.ExprStmt) (err error) {
-	// main 関数直下の assert 関数のみを処理する。
+func processExprStmt(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, exprStmt *ast.ExprStmt) (err error) {
+	// main 関数直下の assert、assume、soft、check および prove 関数のみを処理する。
 
 	// 関数呼び出しかどうかをチェック
 	ce, ok := exprStmt.X.(*ast.CallExpr)
 	if ok {
 		// identifier (args) の形の関数呼び出しか
 		fun, ok := ce.Fun.(*ast.Ident)
-		if ok && fun.Name == "assert" {
+		if ok && (fun.Name == "assert" || fun.Name == "assume") {
+			// assume は前提条件を表す assert の別名
 			var x *z3.AST
 			args := ce.Args
 			if len(args) != 1 {
 				// assert 関数の引数が１以外（０もしくは２以上）の場合はエラー
-				err = fmt.Errorf("assert must have single argument")
+				err = fmt.Errorf("%s must have single argument", fun.Name)
 				return
 			}
 			// assert 関数の第一引数の z3.AST を取得する。
-			x, err = processExpr(ctx, varTab, args[0])
+			x, err = processBoolExpr(ctx, varTab, args[0])
 			if err != nil {
 				return
 			}
 
 			// z3 に登録する。
 			s.Assert(x)
+		} else if ok && fun.Name == "soft" {
+			// ソフト制約
+			err = processSoft(ctx, s, varTab, ce.Args)
+		} else if ok && fun.Name == "check" {
+			// その時点での制約関係のチェック
+			err = processCheck(s, varTab, ce.Args)
+		} else if ok && fun.Name == "prove" {
+			// 式が常に成り立つことの証明
+			err = processProve(ctx, s, varTab, ce.Args)
 		} else {
 			// 他の形式の関数呼び出しはサポート外
 			err = fmt.Errorf("not supported Fun of CallExpr")
@@ -148,8 +398,139 @@ func processExprStmt(ctx *z3.Context, s *z3.Solver, varTab map[string]*z3.AST, e
 	return
 }
 
+// processSoft は soft(expr, weight) および soft(expr, weight, "group") を処理する関数。
+func processSoft(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, args []ast.Expr) (err error) {
+	if len(args) != 2 && len(args) != 3 {
+		err = fmt.Errorf("soft must have 2 or 3 arguments")
+		return
+	}
+	soft := softConstraint{text: types.ExprString(args[0])}
+
+	// 制約
+	soft.x, err = processBoolExpr(ctx, varTab, args[0])
+	if err != nil {
+		return
+	}
+
+	// 重みは 32 ビットの範囲の正の整数リテラルのみ
+	lit, ok := args[1].(*ast.BasicLit)
+	if ok && lit.Kind == token.INT {
+		var w int64
+		w, err = strconv.ParseInt(lit.Value, 0, 32)
+		soft.weight = int(w)
+	}
+	if !ok || lit.Kind != token.INT || err != nil || soft.weight <= 0 {
+		err = fmt.Errorf("weight of soft must be positive integer literal")
+		return
+	}
+
+	// グループ名は文字列リテラルのみ
+	if len(args) == 3 {
+		lit, ok = args[2].(*ast.BasicLit)
+		if ok && lit.Kind == token.STRING {
+			soft.group, err = strconv.Unquote(lit.Value)
+		}
+		if !ok || lit.Kind != token.STRING || err != nil {
+			err = fmt.Errorf("group of soft must be string literal")
+			return
+		}
+	}
+
+	s.AssertSoft(soft)
+	return
+}
+
+// processCheck は check() および check("label") を処理する関数。
+// その時点で登録されている制約関係を解決し、ラベルを付けて結果を表示する。
+func processCheck(s *smtSolver, varTab map[string]*smtlVar, args []ast.Expr) (err error) {
+	s.checks++
+	label := fmt.Sprintf("check %d", s.checks)
+	if len(args) == 1 {
+		lit, ok := args[0].(*ast.BasicLit)
+		if ok && lit.Kind == token.STRING {
+			label, err = strconv.Unquote(lit.Value)
+		}
+		if !ok || lit.Kind != token.STRING || err != nil {
+			err = fmt.Errorf("label of check must be string literal")
+			return
+		}
+	} else if len(args) > 1 {
+		err = fmt.Errorf("check must have single argument at most")
+		return
+	}
+
+	switch s.Check() {
+	case z3.True:
+		s.results = append(s.results, "sat")
+		fmt.Fprintf(s.out, "[%s] sat\n", label)
+		err = printModel(s.out, varTab, s)
+	case z3.False:
+		s.failed++
+		s.results = append(s.results, "unsat")
+		fmt.Fprintf(s.out, "[%s] unsat\n", label)
+	default:
+		s.unknown++
+		s.results = append(s.results, "unknown")
+		fmt.Fprintf(s.out, "[%s] unknown (%s)\n", label, s.reason)
+	}
+	return
+}
+
+// processProve は prove(expr) を処理する関数。
+// その時点で登録されている制約関係 (assume による前提条件) の下で、
+// expr が常に成り立つかどうかを、expr の否定が解決不能かどうかで判定する。
+// 成り立たない場合は反例となる変数の値を表示する。
+func processProve(ctx *z3.Context, s *smtSolver, varTab map[string]*smtlVar, args []ast.Expr) (err error) {
+	if len(args) != 1 {
+		err = fmt.Errorf("prove must have single argument")
+		return
+	}
+	var x *z3.AST
+	x, err = processBoolExpr(ctx, varTab, args[0])
+	if err != nil {
+		return
+	}
+	s.checks++
+	label := types.ExprString(args[0])
+
+	// 否定を登録したスコープで解決を試みる
+	s.Push()
+	s.Assert(x.Not())
+	switch s.Check() {
+	case z3.False:
+		s.results = append(s.results, "valid")
+		fmt.Fprintf(s.out, "[%s] valid\n", label)
+	case z3.True:
+		s.failed++
+		s.results = append(s.results, "invalid")
+		fmt.Fprintf(s.out, "[%s] invalid\n", label)
+		err = printModel(s.out, varTab, s)
+	default:
+		s.unknown++
+		s.results = append(s.results, "unknown")
+		fmt.Fprintf(s.out, "[%s] unknown (%s)\n", label, s.reason)
+	}
+	s.Pop()
+	return
+}
+
+// processBoolExpr は式の型が bool であることを確認した上で、z3.AST を作成する関数
+func processBoolExpr(ctx *z3.Context, varTab map[string]*smtlVar, expr ast.Expr) (r *z3.AST, err error) {
+	var sort string
+	sort, err = exprSort(varTab, expr)
+	if err != nil {
+		return
+	}
+	if sort != sortBool {
+		err = fmt.Errorf("%s is not bool", types.ExprString(expr))
+		return
+	}
+	r, err = processExpr(ctx, varTab, expr)
+	return
+}
+
 // processExpr は入力された式に応じた z3.AST を作成する関数
-func processExpr(ctx *z3.Context, varTab map[string]*z3.AST, expr ast.Expr) (r *z3.AST, err error) {
+func processExpr(ctx *z3.Context, varTab map[string]*smtlVar, expr ast.Expr) (r *z3.AST, err error) {
 	switch expr.(type) {
 	case *ast.Ident:
 		r, err = processIdent(ctx, varTab, expr.(*ast.Ident))
@@ -170,21 +551,30 @@ func processExpr(ctx *z3.Context, varTab map[string]*z3.AST, expr ast.Expr) (r *
 		pe := expr.(*ast.ParenExpr)
 		r, err = processExpr(ctx, varTab, pe.X)
 
+	case *ast.IndexExpr:
+		var name string
+		name, err = indexElemName(varTab, expr.(*ast.IndexExpr))
+		if err == nil {
+			r = varTab[name].x
+		}
+
 	default:
 		err = fmt.Errorf("not supported Expr")
 	}
 	return
 }
 
-func processIdent(ctx *z3.Context, varTab map[string]*z3.AST, ident *ast.Ident) (r *z3.AST, err error) {
+func processIdent(ctx *z3.Context, varTab map[string]*smtlVar, ident *ast.Ident) (r *z3.AST, err error) {
 	switch ident.Name {
 	case "true":
 		r = ctx.True()
 	case "false":
 		r = ctx.False()
 	default:
-		if varTab[ident.Name] != nil {
-			r = varTab[ident.Name]
+		if v := varTab[ident.Name]; v != nil && v.dims != nil {
+			err = fmt.Errorf("array %s must be indexed", ident.Name)
+		} else if v != nil {
+			r = v.x
 		} else {
 			err = fmt.Errorf("%s is unknown variable", ident.Name)
 		}
@@ -192,18 +582,24 @@ func processIdent(ctx *z3.Context, varTab map[string]*z3.AST, ident *ast.Ident)
 	return
 }
 
-func processBasicLit(ctx *z3.Context, varTab map[string]*z3.AST, basicLit *ast.BasicLit) (r *z3.AST, err error) {
-	if basicLit.Kind == token.INT {
-		intVal, err := strconv.Atoi(basicLit.Value)
-		if err == nil {
-			r = ctx.Int(intVal, ctx.IntSort())
-		}
+func processBasicLit(ctx *z3.Context, varTab map[string]*smtlVar, basicLit *ast.BasicLit) (r *z3.AST, err error) {
+	if basicLit.Kind != token.INT {
+		err = fmt.Errorf("not supported Kind of BasicLit")
+		return
+	}
+	// 0x10 や 1_000 などの golang の整数リテラルに対応する。
+	// ctx.Int は 32 ビットの値しか扱えないため、z3.Int64 で 10 進数の数値とする。
+	intVal, e := strconv.ParseInt(basicLit.Value, 0, 64)
+	if e != nil {
+		err = fmt.Errorf("%s is out of range of int", basicLit.Value)
+		return
 	}
+	r = z3.Int64(ctx, intVal)
 	return
 }
 
 // processBinaryExpr は二項演算式を処理し、z3 の AST を作成する関数
-func processBinaryExpr(ctx *z3.Context, varTab map[string]*z3.AST, be *ast.BinaryExpr) (r *z3.AST, err error) {
+func processBinaryExpr(ctx *z3.Context, varTab map[string]*smtlVar, be *ast.BinaryExpr) (r *z3.AST, err error) {
 	var x, y *z3.AST
 	x, err = processExpr(ctx, varTab, be.X)
 	if err == nil {
@@ -247,7 +643,7 @@ func processBOP(op token.Token, x, y *z3.AST) (r *z3.AST, err error) {
 }
 
 // processUnaryExpr は単項演算式を処理し、z3 の AST を作成する関数
-func processUnaryExpr(ctx *z3.Context, varTab map[string]*z3.AST, ue *ast.UnaryExpr) (r *z3.AST, err error) {
+func processUnaryExpr(ctx *z3.Context, varTab map[string]*smtlVar, ue *ast.UnaryExpr) (r *z3.AST, err error) {
 	var x *z3.AST
 	x, err = processExpr(ctx, varTab, ue.X)
 	if err == nil {
@@ -261,7 +657,7 @@ func processUnaryExpr(ctx *z3.Context, varTab map[string]*z3.AST, ue *ast.UnaryE
 	return
 }
 
-func processCallExpr(ctx *z3.Context, varTab map[string]*z3.AST, ce *ast.CallExpr) (r *z3.AST, err error) {
+func processCallExpr(ctx *z3.Context, varTab map[string]*smtlVar, ce *ast.CallExpr) (r *z3.AST, err error) {
 	var args []*z3.AST
 	var e *z3.AST
 	for _, arg := range ce.Args {
@@ -274,17 +670,17 @@ func processCallExpr(ctx *z3.Context, varTab map[string]*z3.AST, ce *ast.CallExp
 	if len(args) == 0 {
 		err = fmt.Errorf("too few argument of CallExpr")
 	}
+	if err != nil {
+		return
+	}
 	switch ce.Fun.(type) {
 	case *ast.Ident:
 		ident := ce.Fun.(*ast.Ident)
-		if ident.Name == "distinct" {
-			if len(args) > 1 {
-				r = args[0].Distinct(args[1:]...)
-			} else {
-				err = fmt.Errorf("distinct must have 2 arguments at least")
-			}
-		} else {
-			err = fmt.Errorf("not supported Name of Indent")
+		switch ident.Name {
+		case "atMost", "atLeast", "exactly", "pbLe", "pbGe", "pbEq":
+			r, err = processPBCall(ctx, varTab, ident.Name, ce.Args, args)
+		default:
+			r, err = processBuiltin(ctx, ident.Name, args)
 		}
 	case *ast.SelectorExpr:
 		se := ce.Fun.(*ast.SelectorExpr)
@@ -315,6 +711,133 @@ func processCallExpr(ctx *z3.Context, varTab map[string]*z3.AST, ce *ast.CallExp
 	return
 }
 
+// processBuiltin は組み込み関数の呼び出しを処理し、z3 の AST を作成する関数
+func processBuiltin(ctx *z3.Context, name string, args []*z3.AST) (r *z3.AST, err error) {
+	switch name {
+	case "distinct":
+		if len(args) > 1 {
+			r = args[0].Distinct(args[1:]...)
+		} else {
+			err = fmt.Errorf("distinct must have 2 arguments at least")
+		}
+	case "sum": // sum(x1, x2, ...) = x1 + x2 + ...
+		r = args[0].Add(args[1:]...)
+	case "count": // count(b1, b2, ...) = 真である bool 式の個数
+		r = countTrue(ctx, args)
+	case "min", "max":
+		r = args[0]
+		for _, a := range args[1:] {
+			if name == "min" {
+				r = a.Lt(r).Ite(a, r)
+			} else {
+				r = a.Gt(r).Ite(a, r)
+			}
+		}
+	case "abs":
+		if len(args) == 1 {
+			zero := ctx.Int(0, ctx.IntSort())
+			r = args[0].Ge(zero).Ite(args[0], zero.Sub(args[0]))
+		} else {
+			err = fmt.Errorf("abs must have single argument")
+		}
+
+	default:
+		err = fmt.Errorf("not supported Name of Indent")
+	}
+	return
+}
+
+// processPBCall は基数制約 atMost(k, b1, b2, ...) などと擬似ブール制約
+// pbLe(k, w1, b1, w2, b2, ...) などを処理し、Z3 のネイティブな制約を作成する関数。
+// k と重みは int の定数式でなければならない。
+func processPBCall(ctx *z3.Context, varTab map[string]*smtlVar, name string, exprs []ast.Expr, args []*z3.AST) (r *z3.AST, err error) {
+	var k int32
+	k, err = pbInt(varTab, name, "k", exprs[0])
+	if err != nil {
+		return
+	}
+
+	switch name {
+	case "atMost", "atLeast", "exactly":
+		if len(args) < 2 {
+			err = fmt.Errorf("%s must have 2 arguments at least", name)
+			return
+		}
+		if k < 0 {
+			err = fmt.Errorf("k of %s must not be negative", name)
+			return
+		}
+		bs := args[1:]
+		switch name {
+		case "atMost":
+			r = z3.AtMost(ctx, bs, uint(k))
+		case "atLeast":
+			r = z3.AtLeast(ctx, bs, uint(k))
+		default:
+			// exactly は重みがすべて 1 の擬似ブール制約とする
+			ones := make([]int32, len(bs))
+			for i := range ones {
+				ones[i] = 1
+			}
+			r = z3.PbEq(ctx, bs, ones, k)
+		}
+
+	default:
+		if len(args) < 3 || len(args)%2 == 0 {
+			err = fmt.Errorf("%s must have k and pairs of weight and bool", name)
+			return
+		}
+		var bs []*z3.AST
+		var coeffs []int32
+		for i := 1; i+1 < len(args); i += 2 {
+			var w int32
+			w, err = pbInt(varTab, name, "weight", exprs[i])
+			if err != nil {
+				return
+			}
+			coeffs = append(coeffs, w)
+			bs = append(bs, args[i+1])
+		}
+		switch name {
+		case "pbLe":
+			r = z3.PbLe(ctx, bs, coeffs, k)
+		case "pbGe":
+			r = z3.PbGe(ctx, bs, coeffs, k)
+		default:
+			r = z3.PbEq(ctx, bs, coeffs, k)
+		}
+	}
+	return
+}
+
+// pbInt は基数制約・擬似ブール制約の k もしくは重みの値を返す関数。
+// Z3 の API は C の int で受け取るため、32 ビットの範囲に限る。
+func pbInt(varTab map[string]*smtlVar, name, what string, expr ast.Expr) (n int32, err error) {
+	val := constValue(varTab, expr)
+	if val == nil {
+		err = fmt.Errorf("%s of %s must be constant int", what, name)
+		return
+	}
+	i, ok := constant.Int64Val(val)
+	if !ok || i < math.MinInt32 || i > math.MaxInt32 {
+		err = fmt.Errorf("%s of %s is out of range of 32-bit int", what, name)
+		return
+	}
+	n = int32(i)
+	return
+}
+
+// countTrue は bool 式のリストのうち真であるものの個数を表す z3 の AST を作成する関数
+func countTrue(ctx *z3.Context, bs []*z3.AST) *z3.AST {
+	one := ctx.Int(1, ctx.IntSort())
+	zero := ctx.Int(0, ctx.IntSort())
+	var terms []*z3.AST
+	for _, b := range bs {
+		terms = append(terms, b.Ite(one, zero))
+	}
+	return zero.Add(terms...)
+}
+
 /*
 func isIdent(expr ast.Expr) (name string, ok bool) {
 	ident, ok := expr.(*ast.Ident)
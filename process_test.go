@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// translateSrc は src を main 関数の中身として処理し、登録された制約を z3 の式の文字列で返す。
+func translateSrc(src string) (asserts []string, err error) {
+	stmts, err := parseSmtlStmts(src)
+	if err != nil {
+		return
+	}
+	ctx := newContext(nil)
+	defer ctx.Close()
+	s := newSmtSolver(ctx, nil, io.Discard)
+	s.dryRun = true
+	defer s.Close()
+	if err = processStmts(ctx, s, map[string]*smtlVar{}, stmts); err != nil {
+		return
+	}
+	for _, x := range s.Asserts() {
+		asserts = append(asserts, x.String())
+	}
+	return
+}
+
+// translateFile は SMTL ファイルの内容 src を一時ファイルに書き出して処理し、
+// 登録された制約を z3 の式の文字列で返す。
+func translateFile(t *testing.T, src string) (asserts []string, err error) {
+	path := filepath.Join(t.TempDir(), "a.smtl")
+	if err = os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, _, err := translateFiles([]string{path}, &options{})
+	if s != nil {
+		defer s.ctx.Close()
+		defer s.Close()
+	}
+	if err != nil {
+		return
+	}
+	for _, x := range s.Asserts() {
+		asserts = append(asserts, x.String())
+	}
+	return
+}
+
+// TestTranslate は main 関数の中の各構文が z3 の式に変換されることを確かめる。
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		// 宣言
+		{"var x int", nil},
+		{"var b bool; assert(b)", []string{"b"}},
+		{"var x, y int = 1, 2", []string{"(= x 1)", "(= y 2)"}},
+		{"var x = 3", []string{"(= x 3)"}},
+		{"var (\n x int\n b = true\n)\nassert(b)", []string{"(= b true)", "b"}},
+		{"const n = 3; var x int; assert(x == n)", []string{"(= x 3)"}},
+		{"const (\n n = 2\n m int = n * 3\n)\nvar x int; assert(x == m)", []string{"(= x (* 2 3))"}},
+		{"var c [2][2]int; assert(c[0][1] == c[1][0])", []string{"(= |c[0][1]| |c[1][0]|)"}},
+
+		// 二項演算と単項演算
+		{"var x, y int; assert(x+y-1 == x*y)", []string{"(= (- (+ x y) 1) (* x y))"}},
+		{"var x, y int; assert(x != y)", []string{"(not (= x y))"}},
+		{"var x, y int; assert(x < y && x <= y || x > y && x >= y)", []string{"(or (and (< x y) (<= x y)) (and (> x y) (>= x y)))"}},
+		{"var a bool; assert(!a)", []string{"(not a)"}},
+		{"var a, b bool; assert(a.implies(b))", []string{"(=> a b)"}},
+		{"var a, b bool; assert(a.iff(b))", []string{"(= a b)"}},
+		{"var x int; assert((x) == 1)", []string{"(= x 1)"}},
+		{"var x int; assert(x == 0x10)", []string{"(= x 16)"}},
+		{"var x int; assert(x == 3000000000)", []string{"(= x 3000000000)"}},
+		{"var x int = 9223372036854775807", []string{"(= x 9223372036854775807)"}},
+
+		// distinct と組み込み関数
+		{"var x, y, z int; assert(distinct(x, y, z))", []string{"(distinct x y z)"}},
+		{"var x, y int; assert(sum(x, y) == 3)", []string{"(= (+ x y) 3)"}},
+		{"var a, b bool; assert(count(a, b) == 1)", []string{"(= (+ 0 (ite a 1 0) (ite b 1 0)) 1)"}},
+		{"var x int; assert(abs(x) == 1)", []string{"(= (ite (>= x 0) x (- 0 x)) 1)"}},
+		{"var x, y int; assert(min(x, y) == 1)", []string{"(= (ite (< y x) y x) 1)"}},
+		{"var x, y int; assert(max(x, y) == 1)", []string{"(= (ite (> y x) y x) 1)"}},
+		{"var a, b bool; assert(atMost(1, a, b))", []string{"((_ at-most 1) a b)"}},
+		{"var a, b bool; assert(atLeast(1, a, b))", []string{"((_ at-least 1) a b)"}},
+		{"var a, b bool; assert(exactly(1, a, b))", []string{"((_ pbeq 1 1 1) a b)"}},
+		{"var a, b bool; assert(pbLe(4, 2, a, 3, b))", []string{"((_ pble 4 2 3) a b)"}},
+		{"var a, b bool; assert(pbGe(4, 2, a, 3, b))", []string{"((_ pbge 4 2 3) a b)"}},
+		{"var a, b bool; assert(pbEq(4, 2, a, 3, b))", []string{"((_ pbeq 4 2 3) a b)"}},
+
+		// soft、check、assume、prove とブロック
+		{"var x int; soft(x == 1, 2)", nil},
+		{"var x int; soft(x == 1, 2, \"g\"); check()", nil},
+		{"var x int; assume(x > 0); prove(x >= 0)", []string{"(> x 0)"}},
+		{"var x int\n{\n assert(x == 1)\n check(\"inner\")\n}\nassert(x == 2)", []string{"(= x 2)"}},
+	}
+	for _, test := range tests {
+		got, err := translateSrc(test.src)
+		if err != nil {
+			t.Errorf("%q: %s", test.src, err)
+			continue
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%q:\ngot  %q\nwant %q", test.src, got, test.want)
+		}
+	}
+}
+
+// TestTranslateFile はトップレベルの宣言と関数が z3 の式に変換されることを確かめる。
+func TestTranslateFile(t *testing.T) {
+	src := `package smtl
+
+var g int
+
+const n = 2
+
+func twice(x int) int {
+	return x * n
+}
+
+func main() {
+	var x int
+	assert(twice(x) == g)
+}
+`
+	got, err := translateFile(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"(= (* x 2) g)"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestTranslateErrors は処理できない記述がエラーとなることを確かめる。
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// 変数と定数
+		{"assert(x == 1)", "x is unknown variable"},
+		{"var x int; var x bool", "var x is already declared"},
+		{"const n = 1; const n = 2", "const n is already declared"},
+		{"var x float64", "type float64 is not supported"},
+		{"var x, y int = 1", "x: 2 names but 1 values"},
+		{"var x int = true", "cannot use true (bool) as int value of var x"},
+		{"var c []int", "slice type []int is not supported"},
+		{"var c [0]int", "length of array [0]int must be positive"},
+		{"var c [1000001]bool", "array [1000001]bool has more than 1000000 elements"},
+		{"var c [1000][1001]int", "array [1000][1001]int has more than 1000000 elements"},
+		{"var c [2]int = 1", "array var c cannot have value"},
+		{"var c [2]int; assert(c == 1)", "array c must be indexed"},
+		{"var c [2]int; assert(c[2] == 1)", "index 2 out of range [0:2]"},
+		{"var x int; const n = x", "x is not constant"},
+		{"var x int; assert(x == 1.5)", "not supported Kind of BasicLit"},
+		{"var x int; assert(x == 99999999999999999999)", "99999999999999999999"},
+
+		// 型と演算
+		{"var x int; var b bool; assert(x + b == 1)", "mismatched types int + bool"},
+		{"var x int; assert(x)", "x is not bool"},
+		{"var x int; assert(x / 2 == 1)", "not supported bop"},
+		{"var x int; assert(!x)", "operand of ! must be bool"},
+		{"var x int; assert(-x == 1)", "not supported"},
+		{"var x int; assert(x.implies(true))", "receiver of implies must be bool"},
+		{"var a bool; assert(a.foo(true))", "not supported Sel.Name of SelectorExpr"},
+
+		// 文と組み込み関数
+		{"var x int; x = 1", "not supported Stmt"},
+		{"var x int; x == 1", "not supported X of ExprStmt"},
+		{"foo(1)", "not supported Fun of CallExpr"},
+		{"assert(true, false)", "assert must have single argument"},
+		{"var x int; assert(distinct(x))", "distinct must have 2 arguments at least"},
+		{"var a bool; assert(atMost(1, a, 2))", "argument 3 of atMost must be bool"},
+		{"var a bool; var k int; assert(atMost(k, a))", "k of atMost must be constant int"},
+		{"const k = 0 - 1; var a bool; assert(atMost(k, a))", "k of atMost must not be negative"},
+		{"var a bool; assert(pbLe(1, 2, a, 3))", "pbLe must have k and pairs of weight and bool"},
+		{"var x int; soft(x == 1)", "soft must have 2 or 3 arguments"},
+		{"var x int; soft(x == 1, 0)", "weight of soft must be positive integer literal"},
+		{"var x int; soft(x == 1, 3000000000)", "weight of soft must be positive integer literal"},
+		{"var x int; soft(x == 1, 1, 2)", "group of soft must be string literal"},
+		{"check(1)", "label of check must be string literal"},
+		{"check(\"a\", \"b\")", "check must have single argument at most"},
+		{"prove()", "prove must have single argument"},
+	}
+	for _, test := range tests {
+		_, err := translateSrc(test.src)
+		if err == nil {
+			t.Errorf("%q: want error %q, got no error", test.src, test.want)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: want error %q, got %q", test.src, test.want, err)
+		}
+	}
+}
+
+// TestSmtlFiles は testdata の SMTL ファイルが期待する解決結果の注釈と一致することを確かめる。
+func TestSmtlFiles(t *testing.T) {
+	paths, err := findSmtlFiles([]string{"testdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		failures, err := testSmtlFile(path, &options{})
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+		}
+		for _, f := range failures {
+			t.Error(f)
+		}
+	}
+}
+
+// TestSmtlFileDefines は smtrun test でも -D の値が適用されることを確かめる。
+func TestSmtlFileDefines(t *testing.T) {
+	path := writeSmtl(t, "package smtl\n\nfunc main() {\n\tconst n = 1\n\tvar x int // want x == 5\n\tassert(x == n)\n}\n")
+	failures, err := testSmtlFile(path, &options{defines: defineList{{name: "n", value: "5"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+}
+
+// TestExpandDepth は関数の展開の入れ子が深すぎる場合にエラーとなることを確かめる。
+func TestExpandDepth(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("package smtl\n\n")
+	for i := 0; i < maxExpandDepth; i++ {
+		fmt.Fprintf(&b, "func f%d(x int) int { return f%d(x) }\n", i, i+1)
+	}
+	fmt.Fprintf(&b, "func f%d(x int) int { return x }\n\n", maxExpandDepth)
+	b.WriteString("func main() {\n\tvar x int\n\tassert(f0(x) == 1)\n}\n")
+	_, err := translateFile(t, b.String())
+	if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("want error nested too deeply, got %v", err)
+	}
+}
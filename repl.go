@@ -0,0 +1,240 @@
+// 対話的に制約関係を解決する REPL
+// コンテクストとソルバーを保持したまま、SMTL のステートメントを
+// 一行ずつ受け付け、制約を少しずつ追加しながら解決する。
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+const (
+	replPrompt = "smtl> "
+	replHelp   = `SMTL statements (var, assert, soft) are added to the solver.
+Commands:
+  :check        check satisfiability
+  :model        print the model of the last :check
+  :push         start a new scope
+  :pop          discard the current scope
+  :eval expr    evaluate expr in the model of the last :check
+  :reset        discard all variables and constraints
+  :load file    load statements of SMTL file
+  :help         print this help
+  :quit         exit
+`
+)
+
+// repl は REPL の状態を保持する構造体。
+type repl struct {
+	ctx    *z3.Context
+	s      *smtSolver
+	varTab map[string]*smtlVar
+	saved  []map[string]*smtlVar // push した時点の変数テーブル
+	sat    bool                  // 最後の :check の結果が解決可能だったか
+	used   bool                  // リセット後にステートメントを処理したか
+	opts   *options
+}
+
+// runRepl は REPL を実行する関数。
+func runRepl(opts *options) int {
+	r := &repl{opts: opts}
+	r.reset()
+	defer func() {
+		r.s.Close()
+		r.ctx.Close()
+	}()
+
+	fmt.Println(`Type ":help" for help.`)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print(replPrompt)
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == ":quit" {
+			break
+		}
+		if err := r.exec(line); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	fmt.Println()
+
+	return exitSat
+}
+
+// reset は変数と制約をすべて破棄する。
+func (r *repl) reset() {
+	r.renew(nil)
+}
+
+// renew はプラグマで指定されたパラメータ fileParams を設定したコンテクストと
+// ソルバーを作り直し、変数と制約をすべて破棄する。
+func (r *repl) renew(fileParams []param) {
+	if r.s != nil {
+		r.s.Close()
+		r.ctx.Close()
+	}
+	params := r.opts.configParams(fileParams)
+	r.ctx = newContext(params)
+	r.s = newSmtSolver(r.ctx, params, os.Stdout)
+	r.s.timeout = r.opts.timeout
+	r.varTab = map[string]*smtlVar{}
+	r.saved = nil
+	r.sat = false
+	r.used = false
+}
+
+// exec は一行の入力を処理する。
+func (r *repl) exec(line string) (err error) {
+	if line == "" {
+		return
+	}
+
+	// コマンド以外は SMTL のステートメントとして処理する
+	if !strings.HasPrefix(line, ":") {
+		return r.execStmts(line)
+	}
+
+	cmd, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch cmd {
+	case ":check":
+		r.sat = false
+		switch r.s.Check() {
+		case z3.True:
+			r.sat = true
+			fmt.Println("sat")
+		case z3.False:
+			fmt.Println("unsat")
+		default:
+			fmt.Printf("unknown (%s)\n", r.s.reason)
+		}
+
+	case ":model":
+		if !r.sat {
+			err = fmt.Errorf("no model; run :check first")
+			break
+		}
+		printModel(os.Stdout, r.varTab, r.s)
+
+	case ":push":
+		// 変数テーブルも合わせて退避する
+		saved := map[string]*smtlVar{}
+		for name, x := range r.varTab {
+			saved[name] = x
+		}
+		r.saved = append(r.saved, saved)
+		r.s.Push()
+
+	case ":pop":
+		if len(r.saved) == 0 {
+			err = fmt.Errorf("no scope to pop")
+			break
+		}
+		r.varTab = r.saved[len(r.saved)-1]
+		r.saved = r.saved[:len(r.saved)-1]
+		r.s.Pop()
+		r.sat = false
+
+	case ":eval":
+		err = r.eval(arg)
+
+	case ":reset":
+		r.reset()
+
+	case ":load":
+		if arg == "" {
+			err = fmt.Errorf(":load must have file name")
+			break
+		}
+		err = r.load(arg)
+
+	case ":help":
+		fmt.Print(replHelp)
+
+	default:
+		err = fmt.Errorf("unknown command %s", cmd)
+	}
+	return
+}
+
+// execStmts は SMTL のステートメントを処理する。
+func (r *repl) execStmts(src string) (err error) {
+	stmts, err := parseSmtlStmts(src)
+	if err != nil {
+		return
+	}
+	r.sat = false
+	r.used = true
+	err = processStmts(r.ctx, r.s, r.varTab, stmts)
+	return
+}
+
+// eval は式を最後の :check で得られたモデルで評価し、その値を表示する。
+func (r *repl) eval(src string) (err error) {
+	if !r.sat {
+		err = fmt.Errorf("no model; run :check first")
+		return
+	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return
+	}
+	if _, err = exprSort(r.varTab, expr); err != nil {
+		return
+	}
+	x, err := processExpr(r.ctx, r.varTab, expr)
+	if err != nil {
+		return
+	}
+	fmt.Println(r.s.Model().Eval(x))
+	return
+}
+
+// load は SMTL ファイルのステートメントを処理する。
+// ファイルはコマンドラインと同様にプラグマと -D の値を反映して読み込む。
+// ソルバーのパラメータ以外のプラグマはコンテクストとソルバーを作り直す必要が
+// あるため、ステートメントを処理する前 (起動直後か :reset の直後) に限る。
+func (r *repl) load(smtlFilePath string) (err error) {
+	fset := token.NewFileSet()
+	stmts, fileParams, err := loadSmtlFiles(fset, []string{smtlFilePath}, r.opts)
+	if err != nil {
+		return
+	}
+	renew := false
+	for _, p := range fileParams {
+		if p.target != targetSolver {
+			renew = true
+			if r.used {
+				err = fmt.Errorf("%s: pragma %s must be loaded before any statement; run :reset first", smtlFilePath, p.key)
+				return
+			}
+		}
+	}
+	if renew {
+		r.renew(fileParams)
+	} else {
+		for _, p := range fileParams {
+			// parseParam でチェック済みのため、エラーとはならない
+			z3.SetSolverParam(r.ctx, r.s.s, p.key, p.value)
+			r.s.params = append(r.s.params, p)
+		}
+	}
+	r.s.fset = fset
+	r.sat = false
+	r.used = true
+	err = processStmts(r.ctx, r.s, r.varTab, stmts)
+	return
+}
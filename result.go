@@ -0,0 +1,123 @@
+// 解決結果の構造化
+// serve コマンドの JSON の応答と -watch の前回の結果との比較のため、
+// 解決結果を文字列ではなく構造体として取得する。
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+// solveResult は解決結果。serve コマンドの /solve の応答となる。
+type solveResult struct {
+	Result   string            `json:"result"`             // sat、unsat、unknown、checked、error のいずれか
+	Model    map[string]string `json:"model,omitempty"`    // 制約関係を満たす変数の値
+	Violated []solveSoft       `json:"violated,omitempty"` // 違反したソフト制約
+	Penalty  int               `json:"penalty,omitempty"`  // 違反したソフト制約の重みの総和
+	Partial  bool              `json:"partial,omitempty"`  // 制限時間内にペナルティの最小化が終わらなかった
+	Reason   string            `json:"reason,omitempty"`   // unknown となった理由
+	Failed   int               `json:"failed,omitempty"`   // 解決不能な check 文と成り立たない prove 文の数
+	Unknown  int               `json:"unknown,omitempty"`  // 結果が不明な check 文と prove 文の数
+	Output   string            `json:"output,omitempty"`   // check 文と prove 文の結果
+	Error    string            `json:"error,omitempty"`
+}
+
+// solveSoft は違反したソフト制約。
+type solveSoft struct {
+	Constraint string `json:"constraint"`
+	Weight     int    `json:"weight"`
+	Group      string `json:"group,omitempty"`
+}
+
+// solveStmtsResult はステートメントリストに記述された制約関係を、params を設定した
+// コンテクストで解決し、結果を返す関数。solveStmts と同じく runStmts で解決し、
+// 結果を文字列ではなく構造体として返す。
+func solveStmtsResult(stmts []ast.Stmt, params []param, opts *options) (res *solveResult) {
+	res = &solveResult{Result: "error"}
+	var out strings.Builder
+	stats := &runStats{}
+	err := runStmts(&out, stmts, params, opts, stats, func(solver *smtSolver, varTab map[string]*smtlVar) (err error) {
+		switch stats.Result {
+		case "checked":
+			res.Failed = solver.failed
+			res.Unknown = solver.unknown
+		case "unknown":
+			res.Reason = solver.reason
+		case "sat":
+			// 制約関係を満たす変数の値と、違反したソフト制約
+			assignments := solver.Model().Assignments()
+			res.Model = map[string]string{}
+			for _, name := range modelNames(varTab, solver) {
+				res.Model[name] = fmt.Sprint(assignments[name])
+			}
+			for _, soft := range solver.Violated() {
+				res.Violated = append(res.Violated, solveSoft{Constraint: soft.text, Weight: soft.weight, Group: soft.group})
+				res.Penalty += soft.weight
+			}
+			res.Partial = !solver.optimal
+		}
+		return
+	})
+	res.Output = out.String()
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	res.Result = stats.Result
+	return
+}
+
+// solveSMTLIBResult は SMT-LIB 2 の文字列に記述された制約を、params を設定した
+// コンテクストで解決し、結果を返す関数。モデルには宣言されたすべての定数の値を含める。
+func solveSMTLIBResult(src string, params []param, opts *options) (res *solveResult) {
+	res = &solveResult{Result: "error"}
+
+	ctx := newContext(params)
+	defer ctx.Close()
+	asserts, err := z3.ParseSMTLIB2(ctx, src)
+	if err != nil {
+		res.Error = err.Error()
+		return
+	}
+	solver := newSmtSolver(ctx, params, nil)
+	solver.timeout = opts.timeout
+	solver.deadline = opts.deadline
+	defer solver.Close()
+	for _, x := range asserts {
+		solver.Assert(x)
+	}
+
+	switch solver.Check() {
+	case z3.False:
+		res.Result = "unsat"
+		return
+	case z3.Undef:
+		res.Result = "unknown"
+		res.Reason = solver.reason
+		return
+	}
+	assignments := solver.Model().Assignments()
+	names := opts.vars
+	if len(names) == 0 {
+		for name := range assignments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	res.Model = map[string]string{}
+	for _, name := range names {
+		x, ok := assignments[name]
+		if !ok {
+			res.Error = fmt.Sprintf("%s is unknown variable", name)
+			return
+		}
+		res.Model[name] = fmt.Sprint(x)
+	}
+	res.Result = "sat"
+	return
+}
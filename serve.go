@@ -0,0 +1,300 @@
+// HTTP による SMTL の解決
+// smtrun serve は次のエンドポイントを提供し、他のツールからコマンドを起動せずに
+// SMTL を解決できるようにする。
+//
+//   - POST /solve: リクエストの SMTL を解決し、結果を JSON で返す
+//   - GET /healthz: サーバーが動作していれば "ok" を返す
+//
+// /solve のリクエストは、SMTL とオプションを含む JSON (Content-Type: application/json)、
+// もしくは SMTL そのものである。リクエストごとに z3 のコンテクストを作成して解決する。
+// リクエストは、インポートを -I のディレクトリに、設定できるパラメータを serveParams に、
+// 解決の時間を一つの期限に、変数の数を -max-vars に制限する。
+// SMT-LIB 2 のリクエスト (Content-Type: application/smtlib、もしくは JSON の smtlib) は
+// z3 パッケージが補う Z3_parse_smtlib2_string で読み込み、同様にリクエストごとの
+// コンテクストで解決する。
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// serveConfig は serve コマンドの設定を保持する構造体。
+type serveConfig struct {
+	addr          string        // 待ち受けるアドレス
+	maxBody       int64         // リクエストの大きさの上限 (バイト)
+	maxConcurrent int           // 同時に解決するリクエストの数の上限
+	maxTimeout    time.Duration // 解決のタイムアウトの上限
+	maxVars       int           // 宣言できる変数 (配列の要素を含む) の数の上限
+}
+
+// serveParams はリクエストの set およびプラグマで設定できるパラメータ。
+// ファイルを書き出す trace や dot_proof_file などのパラメータは設定できない。
+var serveParams = map[string]bool{
+	"auto_config":       true,
+	"logic":             true,
+	"model":             true,
+	"model_validate":    true,
+	"proof":             true,
+	"rlimit":            true,
+	"sat.random_seed":   true,
+	"smt.arith.solver":  true,
+	"smt.random_seed":   true,
+	"smtlib2_compliant": true,
+	"tactic":            true,
+	"timeout":           true,
+	"type_check":        true,
+	"unsat_core":        true,
+	"well_sorted_check": true,
+}
+
+// serveRequest は /solve の JSON のリクエスト。
+type serveRequest struct {
+	SMTL    string                 `json:"smtl"`
+	SMTLIB  string                 `json:"smtlib"`
+	Timeout string                 `json:"timeout"` // "10s" など (上限は -max-timeout)
+	Rlimit  uint                   `json:"rlimit"`
+	Set     map[string]string      `json:"set"`     // Z3 のパラメータ
+	Defines map[string]interface{} `json:"defines"` // -D と同じ定義
+	Vars    []string               `json:"vars"`    // 値を返す変数 (空の場合はすべて)
+}
+
+// serveRequests はリクエストごとの SMTL の名前を作るための通し番号。
+var serveRequests int64
+
+// runServe は serve コマンドを実行する関数。
+func runServe(opts *options, args []string) int {
+	// serve コマンドのオプションの処理
+	cfg := &serveConfig{}
+	fset := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fset.StringVar(&cfg.addr, "addr", ":8080", "listen on `address`")
+	fset.Int64Var(&cfg.maxBody, "max-body", 1<<20, "maximum size of request body in bytes")
+	fset.IntVar(&cfg.maxConcurrent, "max-concurrent", runtime.NumCPU(), "maximum number of requests solved concurrently")
+	fset.DurationVar(&cfg.maxTimeout, "max-timeout", time.Minute, "maximum timeout of solver per request")
+	fset.IntVar(&cfg.maxVars, "max-vars", 100000, "maximum number of variables (including array elements) per request")
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] serve [-addr :8080] [-max-body n] [-max-concurrent n] [-max-timeout d] [-max-vars n]\n", os.Args[0])
+		fset.PrintDefaults()
+	}
+	rest, err := parseInterspersed(fset, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(rest) != 0 || cfg.maxConcurrent < 1 || cfg.maxTimeout <= 0 || cfg.maxVars < 1 {
+		fset.Usage()
+		return exitUsage
+	}
+	opts.banner()
+
+	srv := &http.Server{
+		Addr:              cfg.addr,
+		Handler:           newServeHandler(opts, cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(os.Stderr, "listening on %s\n", cfg.addr)
+	if err = srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitSat
+}
+
+// newServeHandler は /solve と /healthz を処理するハンドラーを作成する関数。
+// httptest.NewServer などに渡してテストにも使用できる。
+func newServeHandler(opts *options, cfg *serveConfig) http.Handler {
+	// 同時に解決するリクエストの数を制限するセマフォ
+	sem := make(chan struct{}, cfg.maxConcurrent)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/solve", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeServeResponse(w, http.StatusMethodNotAllowed, &solveResult{Result: "error", Error: "method must be POST"})
+			return
+		}
+
+		// リクエストの読み込み
+		req, status, err := readServeRequest(w, r, cfg)
+		if err != nil {
+			writeServeResponse(w, status, &solveResult{Result: "error", Error: err.Error()})
+			return
+		}
+
+		// 同時に解決するリクエストの数が上限に達している場合は空くまで待つ
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-r.Context().Done():
+			writeServeResponse(w, http.StatusServiceUnavailable, &solveResult{Result: "error", Error: "server is busy"})
+			return
+		}
+
+		resp := solveRequest(req, opts, cfg)
+		status = http.StatusOK
+		if resp.Result == "error" {
+			status = http.StatusBadRequest
+		}
+		writeServeResponse(w, status, resp)
+	})
+	return mux
+}
+
+// readServeRequest は /solve のリクエストを読み込む関数。
+// 誤りがある場合は応答の HTTP ステータスを返す。
+func readServeRequest(w http.ResponseWriter, r *http.Request, cfg *serveConfig) (req *serveRequest, status int, err error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.maxBody))
+	if err != nil {
+		status = http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			err = fmt.Errorf("request body is larger than %d bytes", cfg.maxBody)
+		}
+		return
+	}
+
+	req = &serveRequest{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(strings.NewReader(string(body)))
+		dec.UseNumber()
+		if err = dec.Decode(req); err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	case "application/smtlib", "application/smt2", "text/x-smt2":
+		req.SMTLIB = string(body)
+	default:
+		req.SMTL = string(body)
+	}
+
+	switch {
+	case req.SMTLIB != "" && req.SMTL != "":
+		status = http.StatusBadRequest
+		err = fmt.Errorf("smtl and smtlib cannot both be set")
+	case req.SMTLIB != "" && len(req.Defines) > 0:
+		status = http.StatusBadRequest
+		err = fmt.Errorf("defines cannot be used with smtlib")
+	case req.SMTLIB != "":
+	case req.SMTL == "":
+		status = http.StatusBadRequest
+		err = fmt.Errorf("SMTL is empty")
+	}
+	return
+}
+
+// writeServeResponse は応答を JSON で書き出す関数。
+func writeServeResponse(w http.ResponseWriter, status int, resp *solveResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// requestOptions はリクエストのオプションを適用したオプションを返す関数。
+// タイムアウトは -max-timeout を超えないようにし、リクエスト全体の期限とする。
+func requestOptions(req *serveRequest, opts *options, cfg *serveConfig) (reqOpts options, err error) {
+	reqOpts = *opts
+	reqOpts.vars = req.Vars
+	reqOpts.portfolio = 0
+	reqOpts.confine = true
+	reqOpts.maxVars = cfg.maxVars
+
+	if req.Timeout != "" {
+		reqOpts.timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil {
+			return
+		}
+	}
+	if reqOpts.timeout <= 0 || reqOpts.timeout > cfg.maxTimeout {
+		reqOpts.timeout = cfg.maxTimeout
+	}
+	reqOpts.deadline = time.Now().Add(reqOpts.timeout)
+	if req.Rlimit > 0 {
+		reqOpts.rlimit = req.Rlimit
+	}
+
+	reqOpts.params = append(paramList{}, opts.params...)
+	for key, value := range req.Set {
+		if key == "timeout" {
+			err = fmt.Errorf("use timeout instead of set.timeout")
+			return
+		}
+		var p param
+		p, err = parseParam(key + "=" + value)
+		if err != nil {
+			return
+		}
+		if err = checkServeParam(p); err != nil {
+			return
+		}
+		reqOpts.params = append(reqOpts.params, p)
+	}
+
+	var defines []define
+	defines, err = definesFromJSON(req.Defines)
+	if err != nil {
+		return
+	}
+	reqOpts.defines = append(append(defineList{}, opts.defines...), defines...)
+	return
+}
+
+// solveRequest はリクエストの SMTL もしくは SMT-LIB を解決し、応答を返す関数。
+func solveRequest(req *serveRequest, opts *options, cfg *serveConfig) (resp *solveResult) {
+	resp = &solveResult{Result: "error"}
+	reqOpts, err := requestOptions(req, opts, cfg)
+	if err != nil {
+		resp.Error = err.Error()
+		return
+	}
+	if req.SMTLIB != "" {
+		// リクエストごとのコンテクストで SMT-LIB を読み込んで解決する
+		resp = solveSMTLIBResult(req.SMTLIB, reqOpts.configParams(nil), &reqOpts)
+		return
+	}
+
+	// リクエストの SMTL をファイルの代わりに登録してパースする
+	path := fmt.Sprintf("request-%d.smtl", atomic.AddInt64(&serveRequests, 1))
+	setSrcOverlay(path, []byte(req.SMTL))
+	reqOpts.fset = token.NewFileSet()
+	stmts, fileParams, err := loadSmtlFiles(reqOpts.fset, []string{path}, &reqOpts)
+	setSrcOverlay(path, nil)
+	if err != nil {
+		resp.Error = err.Error()
+		return
+	}
+	for _, p := range fileParams {
+		if err = checkServeParam(p); err != nil {
+			resp.Error = err.Error()
+			return
+		}
+	}
+
+	// リクエストごとのコンテクストで解決する
+	resp = solveStmtsResult(stmts, reqOpts.configParams(fileParams), &reqOpts)
+	return
+}
+
+// checkServeParam はリクエストで設定できるパラメータかどうかをチェックする関数。
+func checkServeParam(p param) (err error) {
+	if !serveParams[p.key] {
+		err = fmt.Errorf("parameter %s cannot be set in request", p.key)
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newServeTest は -I testdata で /solve と /healthz を処理するテスト用のサーバーを作成する。
+func newServeTest(t *testing.T) *httptest.Server {
+	opts := &options{includes: pathList{"testdata"}}
+	cfg := &serveConfig{maxBody: 1 << 20, maxConcurrent: 2, maxTimeout: 10 * time.Second, maxVars: 100000}
+	srv := httptest.NewServer(newServeHandler(opts, cfg))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// postSolve は /solve にリクエストを送り、応答の HTTP ステータスと解決結果を返す。
+func postSolve(t *testing.T, srv *httptest.Server, contentType, body string) (status int, res solveResult) {
+	resp, err := http.Post(srv.URL+"/solve", contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	status = resp.StatusCode
+	return
+}
+
+// smtlMain は src を main 関数の中身とする SMTL を返す。
+func smtlMain(src string) string {
+	return "package smtl\n\nfunc main() {\n" + src + "\n}\n"
+}
+
+// TestServeHealthz は /healthz が ok を返すことを確かめる。
+func TestServeHealthz(t *testing.T) {
+	srv := newServeTest(t)
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok\n" {
+		t.Errorf("got %d %q, want 200 \"ok\\n\"", resp.StatusCode, body)
+	}
+}
+
+// TestServeSolve は /solve の解決結果と誤りの応答を確かめる。
+func TestServeSolve(t *testing.T) {
+	srv := newServeTest(t)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		result      string
+		model       map[string]string
+		err         string
+	}{
+		{"sat", "text/plain", smtlMain("var x, y int\nassert(x + y == 3 && x - y == 1)"),
+			http.StatusOK, "sat", map[string]string{"x": "2", "y": "1"}, ""},
+		{"unsat", "text/plain", smtlMain("var x int\nassert(x > 1 && x < 2)"),
+			http.StatusOK, "unsat", nil, ""},
+		{"json", "application/json", `{"smtl": "package smtl\nfunc main() { const n = 1; var x int = n }", "defines": {"n": 7}}`,
+			http.StatusOK, "sat", map[string]string{"x": "7"}, ""},
+		{"parse error", "text/plain", smtlMain("var x int\nassert(x ==)"),
+			http.StatusBadRequest, "error", nil, "expected operand"},
+		{"empty", "text/plain", "",
+			http.StatusBadRequest, "error", nil, "SMTL is empty"},
+		{"smtlib", "application/smtlib", "(declare-const x Int)\n(declare-const y Int)\n(assert (and (= (+ x y) 3) (= (- x y) 1)))\n(check-sat)",
+			http.StatusOK, "sat", map[string]string{"x": "2", "y": "1"}, ""},
+		{"smtlib unsat", "application/json", `{"smtlib": "(declare-const x Int) (assert (and (> x 1) (< x 2)))"}`,
+			http.StatusOK, "unsat", nil, ""},
+		{"smtlib error", "application/smtlib", "(assert (> z 1))",
+			http.StatusBadRequest, "error", nil, ""},
+		{"import", "text/plain", "package smtl\n\nimport \"lib/order\"\n\nfunc main() {\n\tvar x, y int\n\tassert(order.Ascending(x, y) && x == 1 && y == 2)\n}\n",
+			http.StatusOK, "sat", map[string]string{"x": "1", "y": "2"}, ""},
+		{"import outside -I", "text/plain", "package smtl\n\nimport \"testdata/lib/order\"\n\nfunc main() {\n\tvar x, y int\n\tassert(order.Ascending(x, y))\n}\n",
+			http.StatusBadRequest, "error", nil, `cannot find package "testdata/lib/order" in any of testdata`},
+		{"set trace", "application/json", `{"smtl": "package smtl\nfunc main() { var x int }", "set": {"trace": "true"}}`,
+			http.StatusBadRequest, "error", nil, "parameter trace cannot be set in request"},
+		{"pragma dot_proof_file", "text/plain", "//smtl:option dot_proof_file=proof.dot\n" + smtlMain("var x int"),
+			http.StatusBadRequest, "error", nil, "parameter dot_proof_file cannot be set in request"},
+		{"large array", "text/plain", smtlMain("var c [100000][100000]int"),
+			http.StatusBadRequest, "error", nil, "array [100000][100000]int has more than 1000000 elements"},
+		{"too many vars", "text/plain", smtlMain("var c [1000][1000]int"),
+			http.StatusBadRequest, "error", nil, "var c exceeds limit of 100000 variables"},
+		{"too many scalars", "text/plain", smtlMain("var c [99999]int\nvar x, y int"),
+			http.StatusBadRequest, "error", nil, "var x exceeds limit of 100000 variables"},
+	}
+	for _, test := range tests {
+		status, res := postSolve(t, srv, test.contentType, test.body)
+		if status != test.status || res.Result != test.result {
+			t.Errorf("%s: got %d %s (%s), want %d %s", test.name, status, res.Result, res.Error, test.status, test.result)
+			continue
+		}
+		if !strings.Contains(res.Error, test.err) {
+			t.Errorf("%s: want error %q, got %q", test.name, test.err, res.Error)
+		}
+		for name, value := range test.model {
+			if res.Model[name] != value {
+				t.Errorf("%s: got %s = %q, want %q", test.name, name, res.Model[name], value)
+			}
+		}
+	}
+}
+
+// TestServeTimeout は timeout がリクエスト全体の期限となり、
+// 複数の check 文があってもその合計が期限を大きく超えないことを確かめる。
+func TestServeTimeout(t *testing.T) {
+	srv := newServeTest(t)
+
+	// x^3 + y^3 = z^3 の正の整数解は存在しないが、ソルバーはそれを示せない
+	src := "var x, y, z, a, b, c int\n" +
+		"assert(x > 0 && y > 0 && z > 0)\n" +
+		"assert(x*x*x + y*y*y + 0*(a+b+c) == z*z*z)\n"
+	timeout := 200 * time.Millisecond
+	body, _ := json.Marshal(map[string]string{"smtl": smtlMain(src), "timeout": timeout.String()})
+	status, res := postSolve(t, srv, "application/json", string(body))
+	if status != http.StatusOK || res.Result != "unknown" || res.Reason == "" {
+		t.Errorf("got %d %s (%s), want 200 unknown with reason", status, res.Result, res.Error)
+	}
+
+	checks := strings.Repeat("check()\n", 6)
+	body, _ = json.Marshal(map[string]string{"smtl": smtlMain(src + checks), "timeout": timeout.String()})
+	start := time.Now()
+	status, res = postSolve(t, srv, "application/json", string(body))
+	if elapsed := time.Since(start); elapsed > 3*timeout {
+		t.Errorf("6 checks took %s, want less than %s", elapsed, 3*timeout)
+	}
+	if status != http.StatusOK || res.Result != "checked" || res.Unknown != 6 {
+		t.Errorf("got %d %s unknown=%d (%s), want 200 checked unknown=6", status, res.Result, res.Unknown, res.Error)
+	}
+}
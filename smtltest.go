@@ -0,0 +1,184 @@
+// SMTL ファイルのテスト
+// SMTL ファイルに記述された期待する解決結果の注釈 (// want: sat、// want x == 13 など) と
+// 実際の解決結果を比較し、go test と同様の形式で結果を表示する。
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+// runTest は test コマンドを実行する関数。
+func runTest(opts *options, args []string) int {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	paths, err := findSmtlFiles(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	code := exitSat
+	for _, path := range paths {
+		start := time.Now()
+		failures, err := testSmtlFile(path, opts)
+		elapsed := time.Since(start).Seconds()
+		switch {
+		case err != nil:
+			fmt.Printf("FAIL\t%s [%s]\n", path, err)
+			code = exitFail
+		case failures == nil:
+			fmt.Printf("?   \t%s\t[no want annotations]\n", path)
+		case len(failures) == 0:
+			fmt.Printf("ok  \t%s\t%.3fs\n", path, elapsed)
+		default:
+			fmt.Printf("--- FAIL: %s (%.2fs)\n", path, elapsed)
+			for _, f := range failures {
+				fmt.Printf("    %s\n", f)
+			}
+			fmt.Printf("FAIL\t%s\t%.3fs\n", path, elapsed)
+			code = exitFail
+		}
+	}
+
+	if code == exitSat {
+		fmt.Println("PASS")
+	} else {
+		fmt.Println("FAIL")
+	}
+	return code
+}
+
+// testSmtlFile は SMTL ファイルを解決し、期待する解決結果の注釈と比較する関数。
+// 注釈と一致しなかったものの説明のリストを返す。
+// 注釈がない場合は nil を返す。
+func testSmtlFile(smtlFilePath string, opts *options) (failures []string, err error) {
+	wants, err := parseSmtlWants(smtlFilePath)
+	if err != nil || len(wants) == 0 {
+		return
+	}
+	failures = []string{}
+
+	// 期待する解決結果。式の注釈のみの場合は解決可能であることを期待する。
+	// check 文および prove 文の結果の注釈は除く。
+	result, errMsg := "sat", ""
+	for _, w := range wants {
+		if w.result != "" && w.call == 0 {
+			result, errMsg = w.result, w.errMsg
+		}
+	}
+
+	// 誤りを期待する場合
+	if result == "error" {
+		_, e := solveFiles(io.Discard, []string{smtlFilePath}, opts, &runStats{})
+		if e == nil {
+			failures = append(failures, fmt.Sprintf("%s: want error, got no error", smtlFilePath))
+		} else if !strings.Contains(e.Error(), errMsg) {
+			failures = append(failures, fmt.Sprintf("%s: want error %q, got %q", smtlFilePath, errMsg, e))
+		}
+		return
+	}
+
+	// SMTL ファイルの処理。
+	// 解決する場合と同じく、プラグマ、-D およびインポートの制限を適用する。
+	fset := token.NewFileSet()
+	stmts, fileParams, err := loadSmtlFiles(fset, []string{smtlFilePath}, opts)
+	if err != nil {
+		return
+	}
+	params := opts.configParams(fileParams)
+	ctx := newContext(params)
+	defer ctx.Close()
+	varTab := map[string]*smtlVar{}
+	solver := newSmtSolver(ctx, params, io.Discard)
+	solver.timeout = opts.timeout
+	solver.deadline = opts.deadline
+	solver.maxVars = opts.maxVars
+	solver.fset = fset
+	defer solver.Close()
+	err = processStmts(ctx, solver, varTab, stmts)
+	if err != nil {
+		return
+	}
+
+	// check 文および prove 文の結果の比較
+	for _, w := range wants {
+		if w.call == 0 {
+			continue
+		}
+		if w.call > len(solver.results) {
+			failures = append(failures, fmt.Sprintf("%s: want %s, got no result", w.pos, w.result))
+		} else if got := solver.results[w.call-1]; got != w.result {
+			failures = append(failures, fmt.Sprintf("%s: want %s, got %s", w.pos, w.result, got))
+		}
+	}
+
+	// 解決結果の比較
+	got := "unknown"
+	switch solver.Check() {
+	case z3.True:
+		got = "sat"
+	case z3.False:
+		got = "unsat"
+	}
+	if got != result {
+		failures = append(failures, fmt.Sprintf("%s: want %s, got %s", smtlFilePath, result, got))
+		return
+	}
+	if got != "sat" {
+		return
+	}
+
+	// 式の注釈がモデルにおいて真となるかどうかの比較
+	m := solver.Model()
+	for _, w := range wants {
+		if w.expr == nil {
+			continue
+		}
+		var x *z3.AST
+		x, err = processBoolExpr(ctx, varTab, w.expr)
+		if err != nil {
+			err = fmt.Errorf("%s: %s", w.pos, err)
+			return
+		}
+		if m.Eval(x).String() == "true" {
+			continue
+		}
+
+		// 式に含まれる変数の値を添えて報告する
+		var values []string
+		seen := map[string]bool{}
+		ast.Inspect(w.expr, func(n ast.Node) bool {
+			var name string
+			switch n.(type) {
+			case *ast.Ident:
+				name = n.(*ast.Ident).Name
+			case *ast.IndexExpr:
+				// 配列の要素 (c[0][1]) は要素の変数の値を添える
+				name, _ = indexElemName(varTab, n.(*ast.IndexExpr))
+				if name == "" {
+					return true
+				}
+			}
+			v := varTab[name]
+			if v != nil && v.x != nil && !seen[name] {
+				seen[name] = true
+				values = append(values, fmt.Sprintf("%s = %s", name, m.Eval(v.x)))
+			}
+			return v == nil || v.x == nil
+		})
+		failures = append(failures, fmt.Sprintf("%s: want %s, got %s",
+			w.pos, types.ExprString(w.expr), strings.Join(values, ", ")))
+	}
+	return
+}
@@ -0,0 +1,333 @@
+// z3.Solver のラッパー。
+// スコープの作成と破棄は z3 パッケージが補う Z3_solver_push と Z3_solver_pop で行う。
+// アサーションとソフト制約もスコープごとに記録しておき、ソフト制約の最小化では
+// 残っているものを Z3 の Optimize に登録する。
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bunji2/smtrun/z3"
+)
+
+// softConstraint はソフト制約を表す構造体。
+type softConstraint struct {
+	x      *z3.AST // 制約
+	weight int     // 違反したときのペナルティ
+	group  string  // グループ名
+	text   string  // 表示用の制約の文字列
+}
+
+// scope は push から pop までの間に登録されたアサーションを保持する構造体。
+type scope struct {
+	asserts []*z3.AST
+	softs   []softConstraint
+}
+
+// smtSolver は z3.Solver をラップした構造体。
+type smtSolver struct {
+	ctx      *z3.Context
+	s        *z3.Solver
+	params   []param            // ソルバーの作成に使用するパラメータ (コンテクストのものは無視する)
+	scopes   []scope            // scopes[0] が最も外側のスコープ
+	model    *z3.Model          // 最後の Check で得られたモデル
+	checks   int                // check 文および prove 文を処理した回数
+	failed   int                // check 文が解決不能、もしくは prove 文が成り立たなかった回数
+	unknown  int                // check 文および prove 文の結果が不明だった回数
+	results  []string           // check 文および prove 文の結果 (sat、valid など) を処理した順に並べたもの
+	out      io.Writer          // check 文および prove 文の結果の出力先
+	vars     []string           // モデルを表示する際に値を表示する変数 (空の場合はすべて)
+	tmpl     *template.Template // モデルを表示するテンプレート (nil の場合は変数の値を並べる)
+	grid     bool               // 配列を格子状に並べてモデルを表示する
+	dryRun   bool               // 解決せずに制約の登録のみを行う
+	timeout  time.Duration      // 一回の Check 全体の制限時間 (0 の場合は無制限)
+	deadline time.Time          // すべての Check に共通の期限 (ゼロ値の場合は無制限)
+	maxVars  int                // 宣言できる変数 (配列の要素を含む) の数の上限 (0 の場合は無制限)
+	nvars    int                // 宣言された変数 (配列の要素を含む) の数
+	fset     *token.FileSet     // 誤りの位置を示すためのファイルセット (nil の場合は位置を示さない)
+	optimal  bool               // 最後の Check でソフト制約の最適化が終わったかどうか
+	reason   string             // 最後の Check の結果が Undef となった理由
+	stats    map[string]float64 // Z3 のソルバーの統計情報の累計
+}
+
+// newSmtSolver は smtSolver を作成する関数。
+// params のうちソルバーのパラメータ、ロジックおよびタクティクをソルバーに設定する。
+// これらは parseParam などでチェック済みでなければならない。
+// check 文および prove 文の結果は out に出力される。
+func newSmtSolver(ctx *z3.Context, params []param, out io.Writer) *smtSolver {
+	s := &smtSolver{
+		ctx:    ctx,
+		params: params,
+		scopes: []scope{{}},
+		out:    out,
+	}
+	s.s = s.newSolver()
+	return s
+}
+
+// newSolver はパラメータに従って z3 のソルバーを作成する。
+// タクティクが指定された場合はロジックより優先する。
+func (s *smtSolver) newSolver() (solver *z3.Solver) {
+	var logic, tactic string
+	for _, p := range s.params {
+		switch p.target {
+		case targetLogic:
+			logic = p.value
+		case targetTactic:
+			tactic = p.value
+		}
+	}
+	switch {
+	case tactic != "":
+		solver = z3.NewSolverFromTactics(s.ctx, strings.Split(tactic, ","))
+	case logic != "":
+		solver = z3.NewSolverForLogic(s.ctx, logic)
+	default:
+		solver = s.ctx.NewSolver()
+	}
+	for _, p := range s.params {
+		if p.target == targetSolver {
+			// parseParam でチェック済みのため、エラーとはならない
+			z3.SetSolverParam(s.ctx, solver, p.key, p.value)
+		}
+	}
+	return
+}
+
+// Close はソルバーとモデルを解放する。
+func (s *smtSolver) Close() {
+	s.setModel(nil)
+	s.s.Close()
+}
+
+// Assert は制約を登録する。
+func (s *smtSolver) Assert(x *z3.AST) {
+	top := &s.scopes[len(s.scopes)-1]
+	top.asserts = append(top.asserts, x)
+	s.s.Assert(x)
+}
+
+// AssertSoft はソフト制約を登録する。
+func (s *smtSolver) AssertSoft(soft softConstraint) {
+	top := &s.scopes[len(s.scopes)-1]
+	top.softs = append(top.softs, soft)
+}
+
+// Push は新しいスコープを開始する。
+func (s *smtSolver) Push() {
+	s.scopes = append(s.scopes, scope{})
+	z3.Push(s.ctx, s.s)
+}
+
+// Pop は現在のスコープを終了し、そのスコープで登録された制約を取り除く。
+func (s *smtSolver) Pop() {
+	if len(s.scopes) < 2 {
+		return
+	}
+	s.scopes = s.scopes[:len(s.scopes)-1]
+	z3.Pop(s.ctx, s.s, 1)
+}
+
+// Softs は登録されているソフト制約のリストを返す。
+func (s *smtSolver) Softs() (softs []softConstraint) {
+	for _, sc := range s.scopes {
+		softs = append(softs, sc.softs...)
+	}
+	return
+}
+
+// Model は最後の Check で得られたモデルを返す。
+// モデルは smtSolver が管理するため、呼び出し側で Close してはならない。
+func (s *smtSolver) Model() *z3.Model {
+	return s.model
+}
+
+func (s *smtSolver) setModel(m *z3.Model) {
+	if s.model != nil {
+		s.model.Close()
+	}
+	s.model = m
+}
+
+// declareVars は name から始まる変数を n 個宣言したことを記録する。
+// 宣言された変数の数が maxVars を超える場合はエラーとする。
+func (s *smtSolver) declareVars(name *ast.Ident, n int) (err error) {
+	if s.maxVars > 0 && n > s.maxVars-s.nvars {
+		err = s.errorf(name.Pos(), "var %s exceeds limit of %d variables", name.Name, s.maxVars)
+		return
+	}
+	s.nvars += n
+	return
+}
+
+// checkRedeclared は名前が varTab に既に宣言されていないかを調べる。
+// 既に宣言されている場合は、fset があれば両方の宣言の位置を示すエラーとなる。
+func (s *smtSolver) checkRedeclared(varTab map[string]*smtlVar, kind string, name *ast.Ident) (err error) {
+	v, ok := varTab[name.Name]
+	if !ok {
+		return
+	}
+	if s.fset == nil || !v.pos.IsValid() {
+		err = s.errorf(name.Pos(), "%s %s is already declared", kind, name.Name)
+		return
+	}
+	err = s.errorf(name.Pos(), "%s %s is already declared at %s", kind, name.Name, s.fset.Position(v.pos))
+	return
+}
+
+// errorf は pos の位置を示すエラーを作成する。fset がない場合は位置を示さない。
+func (s *smtSolver) errorf(pos token.Pos, format string, args ...interface{}) (err error) {
+	err = fmt.Errorf(format, args...)
+	if s.fset != nil && pos.IsValid() {
+		err = fmt.Errorf("%s: %s", s.fset.Position(pos), err)
+	}
+	return
+}
+
+// Check は制約を解決可能かどうかをチェックする。
+// ソフト制約が登録されている場合は、グループの出現順に各グループの
+// ペナルティの総和を最小化したモデルを求める。
+// timeout はソフト制約の最適化を含めた Check 全体に適用され、
+// deadline が設定されている場合はそれより後にはならない。
+// 最適化の途中で制限時間を過ぎた場合はそれまでで最良のモデルを残して
+// optimal を false とする。
+// dryRun の場合は解決せずに Undef を返す。
+func (s *smtSolver) Check() (r z3.LBool) {
+	if s.dryRun {
+		r = z3.Undef
+		s.reason = "not solved"
+		s.setModel(nil)
+		return
+	}
+	deadline := s.deadline
+	if s.timeout > 0 {
+		if d := time.Now().Add(s.timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	s.optimal = true
+	r = s.checkUntil(deadline)
+	if r != z3.True {
+		s.setModel(nil)
+		return
+	}
+	s.setModel(s.s.Model())
+
+	softs := s.Softs()
+	if len(softs) == 0 {
+		return
+	}
+	s.optimize(softs, deadline)
+	return
+}
+
+// optimize は Z3 の Optimize でソフト制約のグループごとのペナルティの総和を
+// グループの出現順に辞書式に最小化し、得られたモデルを model とする。
+// 制限時間を過ぎた場合などは Check で得られたモデルを残して optimal を false とする。
+// Optimize はソルバーのロジック、タクティクおよびパラメータ (timeout を除く) を使用しない。
+func (s *smtSolver) optimize(softs []softConstraint, deadline time.Time) {
+	o := z3.NewOptimize(s.ctx)
+	defer o.Close()
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining <= 0 {
+			s.optimal = false
+			return
+		}
+		o.SetTimeout(uint(remaining))
+	}
+	for _, x := range s.Asserts() {
+		o.Assert(x)
+	}
+	for _, soft := range softs {
+		o.AssertSoft(soft.x, int64(soft.weight), soft.group)
+	}
+	r := o.Check()
+	s.addStats(o.Statistics())
+	if r != z3.True {
+		s.optimal = false
+		return
+	}
+	if m := o.Model(); m != nil {
+		s.setModel(m)
+	}
+}
+
+// checkUntil は期限までに終わるように制限時間を設定してソルバーの Check を行う。
+// 期限を過ぎている場合はチェックせずに Undef を返す。
+// Undef の場合はその理由を reason に記録する。
+func (s *smtSolver) checkUntil(deadline time.Time) (r z3.LBool) {
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining <= 0 {
+			s.reason = "timeout"
+			return z3.Undef
+		}
+		if err := z3.SetSolverParam(s.ctx, s.s, "timeout", strconv.FormatInt(remaining, 10)); err != nil {
+			s.reason = err.Error()
+			return z3.Undef
+		}
+	}
+	r = s.s.Check()
+	if r == z3.Undef {
+		s.reason = z3.ReasonUnknown(s.ctx, s.s)
+	}
+	s.addStats(z3.Statistics(s.ctx, s.s))
+	return
+}
+
+// addStats は Z3 のソルバーの統計情報を累計に加える。
+// ソフト制約の最適化や check 文ではソルバーの Check を繰り返すため、
+// 回数は合計し、メモリの使用量とプロセス全体の累計である割り当ての回数は最大値をとる。
+func (s *smtSolver) addStats(stats map[string]float64) {
+	if s.stats == nil {
+		s.stats = map[string]float64{}
+	}
+	for key, value := range stats {
+		if strings.Contains(key, "memory") || key == "num allocs" {
+			if value > s.stats[key] {
+				s.stats[key] = value
+			}
+		} else {
+			s.stats[key] += value
+		}
+	}
+}
+
+// Violated は最後の Check で得られたモデルにおいて、違反している
+// ソフト制約のリストを返す。
+func (s *smtSolver) Violated() (violated []softConstraint) {
+	if s.model == nil {
+		return
+	}
+	for _, soft := range s.Softs() {
+		if s.model.Eval(soft.x).String() != "true" {
+			violated = append(violated, soft)
+		}
+	}
+	return
+}
+
+// Asserts は登録されている制約のリストを返す。
+func (s *smtSolver) Asserts() (asserts []*z3.AST) {
+	for _, sc := range s.scopes {
+		asserts = append(asserts, sc.asserts...)
+	}
+	return
+}
+
+// NumAsserts は登録されている制約の数を返す。
+func (s *smtSolver) NumAsserts() (n int) {
+	for _, sc := range s.scopes {
+		n += len(sc.asserts)
+	}
+	return
+}
@@ -0,0 +1,52 @@
+// 処理の統計情報
+// smtrun の各処理の所要時間と問題の規模に加え、z3 パッケージの
+// Z3_solver_get_statistics で得た Z3 のソルバーの統計情報
+// (conflicts、decisions、propagations、memory など) を統計情報とする。
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// runStats は統計情報を保持する構造体。
+type runStats struct {
+	File      string             `json:"file"`
+	Result    string             `json:"result"`           // sat、unsat、unknown、checked、error のいずれか
+	Parse     time.Duration      `json:"parse_ns"`         // パースの所要時間
+	Translate time.Duration      `json:"translate_ns"`     // z3 の AST の構築の所要時間
+	Check     time.Duration      `json:"check_ns"`         // 解決の所要時間
+	Vars      int                `json:"vars"`             // 変数の数
+	Asserts   int                `json:"asserts"`          // 制約の数
+	Softs     int                `json:"softs"`            // ソフト制約の数
+	Solver    map[string]float64 `json:"solver,omitempty"` // Z3 のソルバーの統計情報
+}
+
+// print は統計情報を format ("text" もしくは "json") の形式で出力する。
+func (st *runStats) print(w io.Writer, format string) {
+	if format == "json" {
+		b, _ := json.Marshal(st)
+		fmt.Fprintln(w, string(b))
+		return
+	}
+	fmt.Fprintf(w, "file:      %s\n", st.File)
+	fmt.Fprintf(w, "result:    %s\n", st.Result)
+	fmt.Fprintf(w, "parse:     %v\n", st.Parse)
+	fmt.Fprintf(w, "translate: %v\n", st.Translate)
+	fmt.Fprintf(w, "check:     %v\n", st.Check)
+	fmt.Fprintf(w, "vars:      %d\n", st.Vars)
+	fmt.Fprintf(w, "asserts:   %d\n", st.Asserts)
+	fmt.Fprintf(w, "softs:     %d\n", st.Softs)
+	var keys []string
+	for key := range st.Solver {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "z3 %s: %v\n", key, st.Solver[key])
+	}
+}
@@ -0,0 +1,249 @@
+// モデルの表示形式
+// solve の -template はモデルを text/template のテンプレートで表示し、
+// -grid は 2 次元の配列の変数を格子状に並べて表示する。
+// パズルのような問題の結果を、変数の値を並べ直すことなくそのままの形で確認できる。
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// modelData はテンプレートに渡すモデルの値。
+type modelData struct {
+	Names    []string               // 表示する変数と配列の名前 (-var で指定された場合はその変数のみ)
+	Vars     map[string]interface{} // 変数の値 (int は int64、bool は bool、配列は要素の値のスライス)
+	Violated []solveSoft            // 違反したソフト制約
+	Penalty  int                    // 違反したソフト制約のペナルティの総和
+	Optimal  bool                   // 制限時間内にペナルティの最小化が終わったかどうか
+}
+
+// templateFuncs はテンプレートで使用できる関数の表。
+var templateFuncs = template.FuncMap{
+	"grid":    gridText,
+	"join":    joinValues,
+	"pad":     padValue,
+	"seq":     seqInts,
+	"add":     func(x, y interface{}) (int64, error) { return intOp(x, y, func(a, b int64) int64 { return a + b }) },
+	"sub":     func(x, y interface{}) (int64, error) { return intOp(x, y, func(a, b int64) int64 { return a - b }) },
+	"mul":     func(x, y interface{}) (int64, error) { return intOp(x, y, func(a, b int64) int64 { return a * b }) },
+	"isArray": isArrayValue,
+}
+
+// loadModelTemplate はモデルを表示するテンプレートのファイルを読み込む関数。
+func loadModelTemplate(path string) (tmpl *template.Template, err error) {
+	tmpl, err = template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").ParseFiles(path)
+	return
+}
+
+// newModelData はソルバーのモデルからテンプレートに渡す値を作成する関数。
+func newModelData(varTab map[string]*smtlVar, solver *smtSolver) (data *modelData) {
+	m := solver.Model()
+	data = &modelData{Names: modelVarNames(varTab, solver), Vars: map[string]interface{}{}, Optimal: solver.optimal}
+	for name, v := range varTab {
+		switch {
+		case v.isConst:
+			// 定数はモデルに含めない
+		case v.dims != nil:
+			var values []interface{}
+			for _, elem := range v.elems {
+				values = append(values, modelValue(m.Eval(varTab[elem].x).String()))
+			}
+			data.Vars[name] = arrayValues(values, v.dims)
+		default:
+			data.Vars[name] = modelValue(m.Eval(v.x).String())
+		}
+	}
+	for _, soft := range solver.Violated() {
+		data.Violated = append(data.Violated, solveSoft{Constraint: soft.text, Weight: soft.weight, Group: soft.group})
+		data.Penalty += soft.weight
+	}
+	return
+}
+
+// modelValue は z3 の値の文字列を int64 もしくは bool に変換する関数。
+// 負の数は (- 3) のように表されるため -3 に変換する。
+// int64 に収まらない値は文字列のままとする。
+func modelValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if strings.HasPrefix(s, "(- ") && strings.HasSuffix(s, ")") {
+		s = "-" + s[3:len(s)-1]
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	return s
+}
+
+// arrayValues は要素の値の並びを、各次元の長さに従って入れ子のスライスにする関数。
+func arrayValues(values []interface{}, dims []int) []interface{} {
+	if len(dims) == 1 {
+		return values
+	}
+	n := len(values) / dims[0]
+	r := make([]interface{}, dims[0])
+	for i := range r {
+		r[i] = arrayValues(values[i*n:(i+1)*n], dims[1:])
+	}
+	return r
+}
+
+// printGridModel は変数の値を表示する関数。
+// 2 次元以上の配列は行ごとに、1 次元の配列は一行に並べて表示する。
+func printGridModel(w io.Writer, data *modelData) {
+	for _, name := range data.Names {
+		value := data.Vars[name]
+		if !isArrayValue(value) {
+			fmt.Fprintf(w, "%s = %v\n", name, value)
+			continue
+		}
+		text, _ := gridText(value)
+		if arrayDepth(value) == 1 {
+			fmt.Fprintf(w, "%s = %s", name, text)
+			continue
+		}
+		fmt.Fprintf(w, "%s =\n", name)
+		for _, line := range splitLines([]byte(text)) {
+			if line != "\n" {
+				line = "  " + line
+			}
+			fmt.Fprint(w, line)
+		}
+	}
+}
+
+// gridText は配列の値を格子状に並べた文字列を返す関数。
+// 値は右に揃え、2 次元の配列は一行に一つの行を、3 次元以上の配列は
+// 空行で区切った 2 次元の配列の並びとする。
+func gridText(v interface{}) (s string, err error) {
+	values, ok := v.([]interface{})
+	if !ok {
+		err = fmt.Errorf("grid of non-array value %v", v)
+		return
+	}
+
+	// 値の幅の最大値
+	width := 0
+	var measure func(v interface{})
+	measure = func(v interface{}) {
+		if values, ok := v.([]interface{}); ok {
+			for _, x := range values {
+				measure(x)
+			}
+		} else if n := len(fmt.Sprint(v)); n > width {
+			width = n
+		}
+	}
+	measure(values)
+
+	var b strings.Builder
+	var write func(values []interface{}, depth int)
+	write = func(values []interface{}, depth int) {
+		if len(values) == 0 || !isArrayValue(values[0]) {
+			b.WriteString(joinRow(values, width))
+			b.WriteString("\n")
+			return
+		}
+		for i, x := range values {
+			if i > 0 && depth > 2 {
+				b.WriteString("\n")
+			}
+			write(x.([]interface{}), depth-1)
+		}
+	}
+	write(values, arrayDepth(values))
+	s = b.String()
+	return
+}
+
+// arrayDepth は入れ子のスライスの次元の数を返す関数。
+func arrayDepth(v interface{}) (depth int) {
+	for {
+		values, ok := v.([]interface{})
+		if !ok || len(values) == 0 {
+			return
+		}
+		depth++
+		v = values[0]
+	}
+}
+
+// joinRow は値を width に右揃えして空白で区切った文字列を返す関数。
+func joinRow(values []interface{}, width int) string {
+	var cells []string
+	for _, x := range values {
+		cells = append(cells, fmt.Sprintf("%*v", width, x))
+	}
+	return strings.Join(cells, " ")
+}
+
+// joinValues は 1 次元の配列の値を sep で区切った文字列を返す関数。
+func joinValues(v interface{}, sep string) (s string, err error) {
+	values, ok := v.([]interface{})
+	if !ok {
+		err = fmt.Errorf("join of non-array value %v", v)
+		return
+	}
+	var cells []string
+	for _, x := range values {
+		cells = append(cells, fmt.Sprint(x))
+	}
+	s = strings.Join(cells, sep)
+	return
+}
+
+// padValue は値を width に右揃えした文字列を返す関数。width が負の場合は左揃えとする。
+func padValue(width int, v interface{}) string {
+	return fmt.Sprintf("%*v", width, v)
+}
+
+// seqInts は 0 から n-1 までの整数のスライスを返す関数。
+func seqInts(n int) (r []int) {
+	for i := 0; i < n; i++ {
+		r = append(r, i)
+	}
+	return
+}
+
+// intOp は二つの整数の値に演算を適用する関数。
+// テンプレートの整数リテラル (int) とモデルの値 (int64) のどちらも使用できる。
+func intOp(x, y interface{}, op func(a, b int64) int64) (r int64, err error) {
+	var a, b int64
+	if a, err = templateInt(x); err != nil {
+		return
+	}
+	if b, err = templateInt(y); err != nil {
+		return
+	}
+	r = op(a, b)
+	return
+}
+
+// templateInt はテンプレートの値を int64 に変換する関数。
+func templateInt(v interface{}) (n int64, err error) {
+	switch v.(type) {
+	case int:
+		n = int64(v.(int))
+	case int64:
+		n = v.(int64)
+	default:
+		err = fmt.Errorf("%v is not int", v)
+	}
+	return
+}
+
+// isArrayValue は値が配列かどうかを判定する関数。
+func isArrayValue(v interface{}) bool {
+	_, ok := v.([]interface{})
+	return ok
+}
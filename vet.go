@@ -0,0 +1,489 @@
+// SMTL ファイルの検査
+// SMTL として正しくても、モデルの誤りであることが多い次の記述を警告する。
+//
+//   - 宣言されたが使用されない変数
+//   - 値の範囲の制約がないまま distinct に使用される変数
+//   - 常に真もしくは偽となる制約
+//   - 重複した制約
+//   - 制約のつもりで書かれた代入 (x = 3 など)
+//   - 無視されるトップレベルの宣言 (type 宣言、呼ばれない関数、使用されないインポート)
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vetWarning は検査で見つかった警告。
+type vetWarning struct {
+	pos token.Position
+	msg string
+}
+
+// vetVar は検査で使用する変数と定数の情報。
+type vetVar struct {
+	name     string
+	pos      token.Pos
+	isConst  bool
+	sort     string         // 宣言された型 (型を省略した場合は空)
+	val      constant.Value // 定数もしくは初期値の値 (定数式でない場合は nil)
+	used     bool           // 式の中で使用されたか
+	bounded  bool           // 定数との大小比較、もしくは初期値による値の制約があるか
+	reported bool           // distinct の警告を報告済みか
+}
+
+// vetter は SMTL のステートメントリストを検査する構造体。
+type vetter struct {
+	fset     *token.FileSet
+	warnings []vetWarning
+	vars     []*vetVar     // main 関数のパッケージで宣言された変数 (宣言の順)
+	distinct []vetDistinct // distinct に使用された変数
+}
+
+// vetDistinct は distinct に使用された変数とその位置。
+type vetDistinct struct {
+	v   *vetVar
+	pos token.Pos
+}
+
+// runVet は vet コマンドを実行する関数。
+func runVet(opts *options, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] vet file.smtl...\n", os.Args[0])
+		return exitUsage
+	}
+
+	warnings, err := vetFiles(args, opts)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", w.pos, w.msg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(warnings) > 0 {
+		return exitFail
+	}
+	return exitSat
+}
+
+// vetFiles は SMTL ファイルを検査し、位置の順に並べた警告のリストを返す関数。
+// 警告の検査の後に z3 の AST への変換を行い、変換の誤りがあればエラーを返す。
+func vetFiles(smtlFilePaths []string, opts *options) (warnings []vetWarning, err error) {
+	fset := token.NewFileSet()
+	stmts, fileNodes, err := parseSmtlFileSet(fset, smtlFilePaths, opts.searchPath())
+	if err != nil {
+		return
+	}
+
+	v := &vetter{fset: fset}
+	v.vetStmts(map[string]*vetVar{}, map[string]token.Pos{}, stmts)
+	v.vetDistinct()
+	v.vetUnused()
+	v.vetTopLevel(fileNodes)
+
+	warnings = v.warnings
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i].pos, warnings[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	// 変換の誤りのチェック
+	solver, _, err := translateFiles(smtlFilePaths, opts)
+	if solver != nil {
+		solver.Close()
+		solver.ctx.Close()
+	}
+	return
+}
+
+// warn は警告を追加する関数。
+func (v *vetter) warn(pos token.Pos, format string, args ...interface{}) {
+	v.warnings = append(v.warnings, vetWarning{pos: v.fset.Position(pos), msg: fmt.Sprintf(format, args...)})
+}
+
+// vetStmts はステートメントリストを検査する関数。
+// scope は宣言された名前と変数の表、asserts は制約の式と最初の位置の表 (重複の検出用) で、
+// ブロックの中の宣言と制約はブロックの外では破棄されるため、いずれもブロックごとに複製する。
+func (v *vetter) vetStmts(scope map[string]*vetVar, asserts map[string]token.Pos, stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.DeclStmt:
+			gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl)
+			if ok {
+				v.vetGenDecl(scope, gd)
+			}
+
+		case *ast.ExprStmt:
+			v.vetExprStmt(scope, asserts, stmt.(*ast.ExprStmt))
+
+		case *ast.AssignStmt:
+			// x = 3 や x := 3 は制約にならない
+			as := stmt.(*ast.AssignStmt)
+			if len(as.Lhs) == 1 && len(as.Rhs) == 1 {
+				v.warn(as.Pos(), "%s is assignment, not constraint; use assert(%s == %s)",
+					types.ExprString(as.Lhs[0])+" "+as.Tok.String()+" "+types.ExprString(as.Rhs[0]),
+					types.ExprString(as.Lhs[0]), types.ExprString(as.Rhs[0]))
+			} else {
+				v.warn(as.Pos(), "assignment is not constraint; use assert(x == y)")
+			}
+			for _, x := range append(as.Lhs, as.Rhs...) {
+				v.vetExpr(scope, x)
+			}
+
+		case *ast.BlockStmt:
+			// ブロック用の変数と制約の表
+			blockScope := map[string]*vetVar{}
+			for name, x := range scope {
+				blockScope[name] = x
+			}
+			blockAsserts := map[string]token.Pos{}
+			for key, pos := range asserts {
+				blockAsserts[key] = pos
+			}
+			v.vetStmts(blockScope, blockAsserts, stmt.(*ast.BlockStmt).List)
+
+		default:
+			// サポート外のステートメントも変数の使用は記録する
+			v.vetExpr(scope, stmt)
+		}
+	}
+}
+
+// vetGenDecl は const と var の宣言を検査し、宣言された名前を scope に登録する関数。
+func (v *vetter) vetGenDecl(scope map[string]*vetVar, gd *ast.GenDecl) {
+	for _, spec := range gd.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		// 値の式は宣言される名前より前に評価する
+		for _, value := range vs.Values {
+			v.vetExpr(scope, value)
+		}
+		for i, name := range vs.Names {
+			x := &vetVar{name: name.Name, pos: name.Pos(), isConst: gd.Tok == token.CONST}
+			if vs.Type != nil {
+				x.sort = types.ExprString(vs.Type)
+			}
+			if i < len(vs.Values) {
+				x.bounded = true
+				x.val, _ = vetConst(scope, vs.Values[i])
+			}
+			scope[name.Name] = x
+
+			// インポートしたパッケージの変数 (latin.X など) は検査しない
+			if !x.isConst && !strings.Contains(name.Name, ".") {
+				v.vars = append(v.vars, x)
+			}
+		}
+	}
+}
+
+// vetExprStmt は assert などの式のステートメントを検査する関数。
+func (v *vetter) vetExprStmt(scope map[string]*vetVar, asserts map[string]token.Pos, es *ast.ExprStmt) {
+	ce, ok := es.X.(*ast.CallExpr)
+	if !ok {
+		v.vetExpr(scope, es.X)
+		return
+	}
+	fun, _ := ce.Fun.(*ast.Ident)
+	if fun != nil && len(ce.Args) > 0 {
+		switch fun.Name {
+		case "assert", "assume":
+			v.vetTrivial(scope, fun.Name, ce.Args[0])
+
+			// 重複した制約
+			key := types.ExprString(ce.Args[0])
+			if prev, ok := asserts[key]; ok {
+				v.warn(ce.Pos(), "duplicate %s of %s (first at %s)", fun.Name, key, v.fset.Position(prev))
+			} else {
+				asserts[key] = ce.Pos()
+			}
+
+		case "soft":
+			v.vetTrivial(scope, fun.Name, ce.Args[0])
+		}
+	}
+	for _, arg := range ce.Args {
+		v.vetExpr(scope, arg)
+	}
+}
+
+// vetTrivial は制約の式が常に真もしくは偽となるかどうかを検査する関数。
+func (v *vetter) vetTrivial(scope map[string]*vetVar, name string, expr ast.Expr) {
+	// 変数を含まない式
+	if val, ok := vetConst(scope, expr); ok && val.Kind() == constant.Bool {
+		v.warn(expr.Pos(), "%s of %s is always %v", name, types.ExprString(expr), constant.BoolVal(val))
+		return
+	}
+
+	// x == x のような同じ式どうしの比較
+	for {
+		pe, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = pe.X
+	}
+	be, ok := expr.(*ast.BinaryExpr)
+	if !ok || types.ExprString(be.X) != types.ExprString(be.Y) {
+		return
+	}
+	switch be.Op {
+	case token.EQL, token.LEQ, token.GEQ:
+		v.warn(expr.Pos(), "%s of %s is always true", name, types.ExprString(expr))
+	case token.NEQ, token.LSS, token.GTR:
+		v.warn(expr.Pos(), "%s of %s is always false", name, types.ExprString(expr))
+	}
+}
+
+// vetExpr は式の中で使用された変数を記録する関数。
+// 定数との大小比較と distinct への使用も記録する。
+func (v *vetter) vetExpr(scope map[string]*vetVar, expr ast.Node) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.Ident:
+			if x := scope[n.(*ast.Ident).Name]; x != nil {
+				x.used = true
+			}
+
+		case *ast.SelectorExpr:
+			// x.implies(y) のメソッド名は変数ではない
+			v.vetExpr(scope, n.(*ast.SelectorExpr).X)
+			return false
+
+		case *ast.BinaryExpr:
+			be := n.(*ast.BinaryExpr)
+			switch be.Op {
+			case token.EQL, token.LSS, token.LEQ, token.GTR, token.GEQ:
+				if _, ok := vetConst(scope, be.Y); ok {
+					vetBound(scope, be.X)
+				}
+				if _, ok := vetConst(scope, be.X); ok {
+					vetBound(scope, be.Y)
+				}
+			}
+
+		case *ast.CallExpr:
+			ce := n.(*ast.CallExpr)
+			if fun, ok := ce.Fun.(*ast.Ident); ok && fun.Name == "distinct" {
+				for _, arg := range ce.Args {
+					if x := vetIdentVar(scope, arg); x != nil {
+						v.distinct = append(v.distinct, vetDistinct{x, ce.Pos()})
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// vetBound は定数と比較された式が変数であれば、値の制約があるものとして記録する関数。
+func vetBound(scope map[string]*vetVar, expr ast.Expr) {
+	if x := vetIdentVar(scope, expr); x != nil {
+		x.bounded = true
+	}
+}
+
+// vetIdentVar は式が変数 (括弧で囲まれたものを含む) であればその情報を返す関数。
+func vetIdentVar(scope map[string]*vetVar, expr ast.Expr) *vetVar {
+	for {
+		pe, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = pe.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	return scope[ident.Name]
+}
+
+// vetDistinct は値の制約がないまま distinct に使用された int の変数を警告する関数。
+// 値の制約は distinct の後に記述されていてもよい。
+func (v *vetter) vetDistinct() {
+	for _, d := range v.distinct {
+		if d.v.isConst || d.v.bounded || d.v.sort == sortBool || d.v.reported {
+			continue
+		}
+		d.v.reported = true
+		v.warn(d.pos, "%s is used in distinct but has no bounds", d.v.name)
+	}
+}
+
+// vetUnused は宣言されたが使用されない変数を警告する関数。
+// 初期値のある変数は初期値によって値が制約されるため警告しない。
+func (v *vetter) vetUnused() {
+	for _, x := range v.vars {
+		if !x.used && !x.bounded {
+			v.warn(x.pos, "var %s is declared but not used", x.name)
+		}
+	}
+}
+
+// vetTopLevel は SMTL ファイルのトップレベルの宣言のうち、無視されるものを警告する関数。
+func (v *vetter) vetTopLevel(fileNodes []*ast.File) {
+	// 関数の呼び出しと、パッケージを修飾に使用した名前を集める
+	called := map[string]bool{}
+	hasMain := false
+	for _, fileNode := range fileNodes {
+		ast.Inspect(fileNode, func(n ast.Node) bool {
+			if ce, ok := n.(*ast.CallExpr); ok {
+				if fun, ok := ce.Fun.(*ast.Ident); ok {
+					called[fun.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	for _, fileNode := range fileNodes {
+		qualifiers := map[string]bool{}
+		ast.Inspect(fileNode, func(n ast.Node) bool {
+			if se, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := se.X.(*ast.Ident); ok {
+					qualifiers[ident.Name] = true
+				}
+			}
+			return true
+		})
+
+		for _, decl := range fileNode.Decls {
+			switch decl.(type) {
+			case *ast.GenDecl:
+				gd := decl.(*ast.GenDecl)
+				switch gd.Tok {
+				case token.TYPE:
+					for _, spec := range gd.Specs {
+						ts := spec.(*ast.TypeSpec)
+						v.warn(ts.Pos(), "type %s is ignored", ts.Name.Name)
+					}
+				case token.IMPORT:
+					for _, spec := range gd.Specs {
+						is := spec.(*ast.ImportSpec)
+						// パッケージ名はインポートパスの最後の要素とみなす
+						importPath, _ := strconv.Unquote(is.Path.Value)
+						name := path.Base(importPath)
+						if is.Name != nil {
+							name = is.Name.Name
+						}
+						if !qualifiers[name] {
+							v.warn(is.Pos(), "import %s is not used", is.Path.Value)
+						}
+					}
+				}
+
+			case *ast.FuncDecl:
+				fd := decl.(*ast.FuncDecl)
+				if fd.Name.Name == "main" && fd.Recv == nil {
+					hasMain = true
+				} else if !called[fd.Name.Name] {
+					v.warn(fd.Pos(), "func %s is declared but not called", fd.Name.Name)
+				}
+			}
+		}
+	}
+
+	if !hasMain && len(fileNodes) > 0 {
+		v.warn(fileNodes[0].Name.Pos(), "func main is not declared; there are no constraints")
+	}
+}
+
+// vetConst は変数を含まない式の値を求める関数。
+// 定数式でない場合、もしくは z3 と golang で値が異なりうる場合は ok が false となる。
+func vetConst(scope map[string]*vetVar, expr ast.Expr) (val constant.Value, ok bool) {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		if bl.Kind == token.INT {
+			val = constant.MakeFromLiteral(bl.Value, token.INT, 0)
+			ok = val.Kind() == constant.Int
+		}
+
+	case *ast.Ident:
+		name := expr.(*ast.Ident).Name
+		if x := scope[name]; x != nil {
+			if x.isConst && x.val != nil {
+				val, ok = x.val, true
+			}
+		} else if name == "true" || name == "false" {
+			val, ok = constant.MakeBool(name == "true"), true
+		}
+
+	case *ast.ParenExpr:
+		val, ok = vetConst(scope, expr.(*ast.ParenExpr).X)
+
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		var x constant.Value
+		if x, ok = vetConst(scope, ue.X); !ok {
+			return
+		}
+		switch {
+		case (ue.Op == token.SUB || ue.Op == token.ADD) && x.Kind() == constant.Int,
+			ue.Op == token.NOT && x.Kind() == constant.Bool:
+			val = constant.UnaryOp(ue.Op, x, 0)
+		default:
+			ok = false
+		}
+
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		var x, y constant.Value
+		if x, ok = vetConst(scope, be.X); !ok {
+			return
+		}
+		if y, ok = vetConst(scope, be.Y); !ok {
+			return
+		}
+		ok = false
+		if x.Kind() != y.Kind() {
+			return
+		}
+		isInt := x.Kind() == constant.Int
+		switch be.Op {
+		case token.ADD, token.SUB, token.MUL:
+			if isInt {
+				val, ok = constant.BinaryOp(x, be.Op, y), true
+			}
+		case token.QUO, token.REM:
+			// 負の数の除算は z3 と golang で結果が異なるため、非負の数に限る
+			if isInt && constant.Sign(x) >= 0 && constant.Sign(y) > 0 {
+				op := token.QUO_ASSIGN // 整数の除算
+				if be.Op == token.REM {
+					op = token.REM
+				}
+				val, ok = constant.BinaryOp(x, op, y), true
+			}
+		case token.EQL, token.NEQ:
+			val, ok = constant.MakeBool(constant.Compare(x, be.Op, y)), true
+		case token.LSS, token.LEQ, token.GTR, token.GEQ:
+			if isInt {
+				val, ok = constant.MakeBool(constant.Compare(x, be.Op, y)), true
+			}
+		case token.LAND, token.LOR:
+			if !isInt {
+				val, ok = constant.BinaryOp(x, be.Op, y), true
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,196 @@
+// SMTL ファイルの監視
+// solve -watch は SMTL ファイルとインポートしたパッケージのファイルの更新時刻を
+// 定期的に調べ、更新されるたびに解決し直す。
+// 前回の解決結果と比較し、値が変わった変数を強調して表示する。
+
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// 値が変わった変数を強調する端末のエスケープシーケンス
+	watchHighlight = "\x1b[1;33m"
+	watchReset     = "\x1b[0m"
+)
+
+// runWatch は SMTL ファイルが更新されるたびに解決し、前回の結果との違いを w に出力する関数。
+// 中断されるまで戻らない。
+func runWatch(w io.Writer, smtlFilePaths []string, opts *options, interval time.Duration) int {
+	for _, path := range smtlFilePaths {
+		if path == stdinPath {
+			fmt.Fprintln(os.Stderr, "-watch cannot be used with stdin")
+			return exitUsage
+		}
+	}
+	color := isTerminal(w)
+
+	var prev *solveResult
+	var mtimes map[string]time.Time
+	for ; ; time.Sleep(interval) {
+		// 更新時刻が変わったファイルがなければ何もしない
+		files := watchFiles(smtlFilePaths, opts)
+		cur := map[string]time.Time{}
+		for _, file := range files {
+			if fi, err := os.Stat(file); err == nil {
+				cur[file] = fi.ModTime()
+			}
+		}
+		if !changedMtimes(mtimes, cur) {
+			continue
+		}
+		mtimes = cur
+
+		// パース、変換および解決
+		fmt.Fprintf(w, "--- %s\n", time.Now().Format("15:04:05"))
+		res := &solveResult{Result: "error"}
+		fileOpts := *opts
+		fileOpts.fset = token.NewFileSet()
+		stmts, fileParams, err := loadSmtlFiles(fileOpts.fset, smtlFilePaths, &fileOpts)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res = solveStmtsResult(stmts, fileOpts.configParams(fileParams), &fileOpts)
+		}
+		printResultDiff(w, prev, res, color)
+		prev = res
+	}
+}
+
+// watchFiles は監視するファイルのリストを返す関数。
+// SMTL ファイルと、インポートしたパッケージの SMTL ファイルを監視する。
+// パースできない場合は指定された SMTL ファイルのみを監視する。
+func watchFiles(smtlFilePaths []string, opts *options) (files []string) {
+	files = append(files, smtlFilePaths...)
+	fset := token.NewFileSet()
+	parseSmtlFileSet(fset, smtlFilePaths, opts.searchPath())
+	seen := map[string]bool{}
+	for _, path := range smtlFilePaths {
+		seen[path] = true
+	}
+	fset.Iterate(func(f *token.File) bool {
+		if !seen[f.Name()] {
+			seen[f.Name()] = true
+			files = append(files, f.Name())
+		}
+		return true
+	})
+	return
+}
+
+// changedMtimes はファイルの更新時刻の表が変わったかどうかを判定する関数。
+func changedMtimes(prev, cur map[string]time.Time) bool {
+	if prev == nil || len(prev) != len(cur) {
+		return true
+	}
+	for file, t := range cur {
+		if pt, ok := prev[file]; !ok || !pt.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// printResultDiff は解決結果を出力する関数。
+// 前回も解決可能だった場合は、値が変わった変数に "*" を付けて前回の値を添え、
+// 追加された変数と取り除かれた変数も示す。
+func printResultDiff(w io.Writer, prev, res *solveResult, color bool) {
+	fmt.Fprint(w, res.Output)
+	switch res.Result {
+	case "error":
+		fmt.Fprintln(w, res.Error)
+		return
+	case "unsat":
+		fmt.Fprintln(w, "Unsolveable")
+		return
+	case "unknown":
+		fmt.Fprintf(w, "Unknown (%s)\n", res.Reason)
+		return
+	case "checked":
+		return
+	}
+
+	var names []string
+	for name := range res.Model {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 前回の結果と比較するのは、前回も解決可能だった場合のみ
+	var prevModel map[string]string
+	if prev != nil && prev.Result == "sat" {
+		prevModel = prev.Model
+	}
+	changed := 0
+	for _, name := range names {
+		value := res.Model[name]
+		prevValue, ok := prevModel[name]
+		switch {
+		case prevModel == nil || (ok && prevValue == value):
+			fmt.Fprintf(w, "  %s = %s\n", name, value)
+			continue
+		case !ok:
+			line := fmt.Sprintf("* %s = %s (new)", name, value)
+			fmt.Fprintln(w, highlight(line, color))
+		default:
+			line := fmt.Sprintf("* %s = %s (was %s)", name, value, prevValue)
+			fmt.Fprintln(w, highlight(line, color))
+		}
+		changed++
+	}
+
+	// 前回の結果にあって今回の結果にない変数
+	var removed []string
+	for name := range prevModel {
+		if _, ok := res.Model[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		fmt.Fprintln(w, highlight(fmt.Sprintf("* %s (removed)", name), color))
+	}
+
+	// 違反したソフト制約とペナルティの総和
+	for _, soft := range res.Violated {
+		if soft.Group == "" {
+			fmt.Fprintf(w, "violated: %s (weight %d)\n", soft.Constraint, soft.Weight)
+		} else {
+			fmt.Fprintf(w, "violated: %s (weight %d, group %q)\n", soft.Constraint, soft.Weight, soft.Group)
+		}
+	}
+	if len(res.Violated) > 0 || (prev != nil && len(prev.Violated) > 0) {
+		if res.Partial {
+			fmt.Fprintf(w, "penalty = %d (not proven minimal)\n", res.Penalty)
+		} else {
+			fmt.Fprintf(w, "penalty = %d\n", res.Penalty)
+		}
+	}
+	if prevModel != nil {
+		fmt.Fprintf(w, "%d of %d variables changed\n", changed+len(removed), len(names)+len(removed))
+	}
+}
+
+// highlight は color が真の場合に文字列を強調する関数。
+func highlight(s string, color bool) string {
+	if !color {
+		return s
+	}
+	return watchHighlight + s + watchReset
+}
+
+// isTerminal は w が端末かどうかを判定する関数。
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
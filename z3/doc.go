@@ -0,0 +1,13 @@
+// Package z3 は smtrun が使用する Z3 の API。
+// go-z3 の型と関数をそのまま公開し、go-z3 が提供していない Z3 の API を cgo で補う。
+//
+// go-z3 は Z3 の生のハンドル (Z3_context や Z3_ast) を公開していないため、
+// go-z3 の構造体と同じ配置の構造体を介して unsafe で取り出す。
+// go-z3 の構造体の配置が変わった場合は raw* の構造体も合わせて修正すること。
+// ヘッダーとライブラリは go-z3 のもの (vendor/z3 と libz3.a) を使用する。
+//
+// cgo が無効で fakez3 タグを指定した場合は Z3 の代わりに偽のバックエンド (fake.go) を使用する。
+// 偽のバックエンドは作成した式を文字列として記録し、小さな問題を総当たりで解くため、
+// cgo と Z3 のない環境でも go test -tags fakez3 で変換の結果を確かめられる。
+// 偽のバックエンドは正しい解決器ではないため、fakez3 タグなしで cgo を無効にするとビルドできない。
+package z3
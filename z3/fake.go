@@ -0,0 +1,347 @@
+//go:build !cgo && fakez3
+
+// cgo を使用しない偽のバックエンド
+// go-z3 と同じ型とメソッドを提供し、作成された AST は Z3 と同じ SMT-LIB 形式の
+// 文字列として記録する。解決は int の変数の値を fakeIntMin から fakeIntMax の
+// 範囲に限った総当たりで行う。範囲が定数との比較で狭く限られた問題でなければ
+// 解がないとは判断せず、結果は Undef とする。
+// go test -tags fakez3 でのみ使用し、smtrun の実行ファイルには含めない。
+
+package z3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// LBool は解決結果。
+type LBool int8
+
+// 解決結果
+const (
+	False LBool = -1
+	Undef LBool = 0
+	True  LBool = 1
+)
+
+// Config はコンテクストの設定。
+type Config struct {
+	params map[string]string
+}
+
+// NewConfig はコンテクストの設定を作成する。
+func NewConfig() *Config {
+	return &Config{params: map[string]string{}}
+}
+
+// Close は設定を解放する。
+func (c *Config) Close() error {
+	return nil
+}
+
+// SetParamValue はコンテクストのパラメータを設定する。
+func (c *Config) SetParamValue(k, v string) {
+	c.params[k] = v
+}
+
+// Context はコンテクスト。
+type Context struct {
+	timeout     uint  // コンテクストのパラメータ timeout (ミリ秒、0 の場合は無制限)
+	interrupted int32 // Interrupt で中断された
+}
+
+// NewContext はコンテクストを作成する。
+func NewContext(config *Config) *Context {
+	ctx := &Context{}
+	if v, err := strconv.ParseUint(config.params["timeout"], 10, 32); err == nil {
+		ctx.timeout = uint(v)
+	}
+	return ctx
+}
+
+// Close はコンテクストを解放する。
+func (c *Context) Close() error {
+	return nil
+}
+
+// Symbol はシンボル。
+type Symbol struct {
+	name string
+}
+
+// Symbol はシンボルを作成する。
+func (c *Context) Symbol(name string) *Symbol {
+	return &Symbol{name: name}
+}
+
+// String はシンボルの名前を返す。
+func (s *Symbol) String() string {
+	return s.name
+}
+
+// Sort はソート。
+type Sort struct {
+	name string
+}
+
+// ソート
+var (
+	intSort  = &Sort{name: "Int"}
+	boolSort = &Sort{name: "Bool"}
+)
+
+// IntSort は int のソートを返す。
+func (c *Context) IntSort() *Sort {
+	return intSort
+}
+
+// BoolSort は bool のソートを返す。
+func (c *Context) BoolSort() *Sort {
+	return boolSort
+}
+
+// AST は式。
+type AST struct {
+	op     string  // SMT-LIB の演算子。定数は "const"、数値は "num"
+	name   string  // 定数の名前
+	val    int64   // 数値の値
+	sort   *Sort   // 式のソート
+	args   []*AST  // 引数
+	params []int64 // 基数制約・擬似ブール制約の k と重み
+}
+
+// Const は定数 (SMT の変数) を作成する。
+func (c *Context) Const(s *Symbol, t *Sort) *AST {
+	return &AST{op: "const", name: s.name, sort: t}
+}
+
+// Int は数値を作成する。
+func (c *Context) Int(v int, t *Sort) *AST {
+	return &AST{op: "num", val: int64(v), sort: t}
+}
+
+// True は真を作成する。
+func (c *Context) True() *AST {
+	return &AST{op: "true", sort: boolSort}
+}
+
+// False は偽を作成する。
+func (c *Context) False() *AST {
+	return &AST{op: "false", sort: boolSort}
+}
+
+// Int は数値の値を返す。
+func (a *AST) Int() int {
+	return int(a.val)
+}
+
+// String は式を Z3 と同じ SMT-LIB 形式の文字列で返す。
+func (a *AST) String() string {
+	switch a.op {
+	case "const":
+		return quoteSymbol(a.name)
+	case "num":
+		if a.val < 0 {
+			return fmt.Sprintf("(- %d)", -a.val)
+		}
+		return strconv.FormatInt(a.val, 10)
+	case "true", "false":
+		return a.op
+	}
+	var head string
+	switch a.op {
+	case "at-most", "at-least":
+		head = fmt.Sprintf("(_ %s %d)", a.op, a.params[0])
+	case "pble", "pbge", "pbeq":
+		var ps []string
+		for _, p := range a.params {
+			ps = append(ps, strconv.FormatInt(p, 10))
+		}
+		head = fmt.Sprintf("(_ %s %s)", a.op, strings.Join(ps, " "))
+	default:
+		head = a.op
+	}
+	ss := []string{head}
+	for _, x := range a.args {
+		ss = append(ss, x.String())
+	}
+	return "(" + strings.Join(ss, " ") + ")"
+}
+
+// quoteSymbol は SMT-LIB の単純なシンボルとならない名前を |name| とする。
+func quoteSymbol(name string) string {
+	for i, r := range name {
+		simple := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || strings.ContainsRune("~!@$%^&*_-+=<>.?/", r) ||
+			(i > 0 && r >= '0' && r <= '9')
+		if !simple {
+			return "|" + name + "|"
+		}
+	}
+	return name
+}
+
+// op は演算の AST を作成する。
+func op(name string, sort *Sort, args ...*AST) *AST {
+	return &AST{op: name, sort: sort, args: args}
+}
+
+// Add は a + args... を作成する。
+func (a *AST) Add(args ...*AST) *AST {
+	return op("+", intSort, append([]*AST{a}, args...)...)
+}
+
+// Sub は a - args... を作成する。
+func (a *AST) Sub(args ...*AST) *AST {
+	return op("-", intSort, append([]*AST{a}, args...)...)
+}
+
+// Mul は a * args... を作成する。
+func (a *AST) Mul(args ...*AST) *AST {
+	return op("*", intSort, append([]*AST{a}, args...)...)
+}
+
+// Distinct は a と args の値がすべて異なるという式を作成する。
+func (a *AST) Distinct(args ...*AST) *AST {
+	return op("distinct", boolSort, append([]*AST{a}, args...)...)
+}
+
+// And は論理積を作成する。
+func (a *AST) And(args ...*AST) *AST {
+	return op("and", boolSort, append([]*AST{a}, args...)...)
+}
+
+// Or は論理和を作成する。
+func (a *AST) Or(args ...*AST) *AST {
+	return op("or", boolSort, append([]*AST{a}, args...)...)
+}
+
+// Lt は a < b を作成する。
+func (a *AST) Lt(b *AST) *AST { return op("<", boolSort, a, b) }
+
+// Le は a <= b を作成する。
+func (a *AST) Le(b *AST) *AST { return op("<=", boolSort, a, b) }
+
+// Gt は a > b を作成する。
+func (a *AST) Gt(b *AST) *AST { return op(">", boolSort, a, b) }
+
+// Ge は a >= b を作成する。
+func (a *AST) Ge(b *AST) *AST { return op(">=", boolSort, a, b) }
+
+// Not は否定を作成する。
+func (a *AST) Not() *AST { return op("not", boolSort, a) }
+
+// Eq は a == b を作成する。
+func (a *AST) Eq(b *AST) *AST { return op("=", boolSort, a, b) }
+
+// Ite は a ? b : c を作成する。
+func (a *AST) Ite(b, c *AST) *AST { return op("ite", b.sort, a, b, c) }
+
+// Iff は a と b が同値であるという式を作成する。Z3 と同じく = と表す。
+func (a *AST) Iff(b *AST) *AST { return op("=", boolSort, a, b) }
+
+// Implies は a ならば b を作成する。
+func (a *AST) Implies(b *AST) *AST { return op("=>", boolSort, a, b) }
+
+// Xor は排他的論理和を作成する。
+func (a *AST) Xor(b *AST) *AST { return op("xor", boolSort, a, b) }
+
+// Solver はソルバー。
+type Solver struct {
+	ctx     *Context
+	asserts []*AST
+	scopes  []int             // Push した時点の制約の数
+	params  map[string]string // SetSolverParam で設定されたパラメータ
+	model   map[string]int64  // 最後の Check で得られたモデル
+	reason  string            // 最後の Check が Undef となった理由
+	stats   map[string]float64
+}
+
+// NewSolver はソルバーを作成する。
+func (c *Context) NewSolver() *Solver {
+	return &Solver{ctx: c, params: map[string]string{}}
+}
+
+// Close はソルバーを解放する。
+func (s *Solver) Close() error {
+	return nil
+}
+
+// Assert は制約を登録する。
+func (s *Solver) Assert(a *AST) {
+	s.asserts = append(s.asserts, a)
+}
+
+// Push はソルバーに新しいスコープを作成する。
+func Push(ctx *Context, s *Solver) {
+	s.scopes = append(s.scopes, len(s.asserts))
+}
+
+// Pop はソルバーのスコープを n 個取り除き、その中で登録された制約を取り除く。
+func Pop(ctx *Context, s *Solver, n uint) {
+	if n == 0 || int(n) > len(s.scopes) {
+		return
+	}
+	i := len(s.scopes) - int(n)
+	s.asserts = s.asserts[:s.scopes[i]]
+	s.scopes = s.scopes[:i]
+}
+
+// Check は制約を解決可能かどうかをチェックする。
+func (s *Solver) Check() LBool {
+	atomic.StoreInt32(&s.ctx.interrupted, 0)
+	timeout := s.ctx.timeout
+	if v, err := strconv.ParseUint(s.params["timeout"], 10, 32); err == nil {
+		timeout = uint(v)
+	}
+	r, model, st := search(s.ctx, s.asserts, timeout)
+	s.model, s.stats, s.reason = model, st.values(), st.reason
+	return r
+}
+
+// Model は最後の Check で得られたモデルを返す。
+func (s *Solver) Model() *Model {
+	return &Model{values: s.model, asserts: s.asserts}
+}
+
+// Model はモデル。
+type Model struct {
+	values  map[string]int64
+	asserts []*AST
+}
+
+// Close はモデルを解放する。
+func (m *Model) Close() error {
+	return nil
+}
+
+// Eval はモデルにおける式の値を返す。モデルにない定数の値は 0 もしくは偽とする。
+func (m *Model) Eval(a *AST) *AST {
+	v := eval(a, m.values)
+	if a.sort == boolSort {
+		if v != 0 {
+			return &AST{op: "true", sort: boolSort}
+		}
+		return &AST{op: "false", sort: boolSort}
+	}
+	return &AST{op: "num", val: v, sort: intSort}
+}
+
+// Assignments は制約に含まれる定数の値の表を返す。
+func (m *Model) Assignments() map[string]*AST {
+	r := map[string]*AST{}
+	for _, c := range constsOf(m.asserts) {
+		r[c.name] = m.Eval(c)
+	}
+	return r
+}
+
+// String はモデルを文字列で返す。
+func (m *Model) String() string {
+	var ss []string
+	for _, c := range constsOf(m.asserts) {
+		ss = append(ss, fmt.Sprintf("%s -> %s", c, m.Eval(c)))
+	}
+	return strings.Join(ss, "\n")
+}
@@ -0,0 +1,128 @@
+//go:build !cgo && fakez3
+
+// 偽のバックエンドのソフト制約の最適化
+// 目的関数ごとに、違反した制約の重みの総和の上限を二分探索で狭めて最小化する。
+
+package z3
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Optimize はソフト制約を最適化するソルバー。
+type Optimize struct {
+	ctx     *Context
+	asserts []*AST
+	softs   map[string][]*AST // 目的関数ごとの違反した制約の重みの項
+	ids     []string          // 目的関数を登録された順に並べたもの
+	timeout uint              // 制限時間 (ミリ秒、0 の場合は無制限)
+	model   map[string]int64
+	reason  string
+	stats   map[string]float64
+}
+
+// NewOptimize は Optimize を作成する。
+func NewOptimize(ctx *Context) *Optimize {
+	return &Optimize{ctx: ctx, softs: map[string][]*AST{}, timeout: ctx.timeout}
+}
+
+// Close は Optimize を解放する。
+func (o *Optimize) Close() error {
+	return nil
+}
+
+// Assert は制約を登録する。
+func (o *Optimize) Assert(x *AST) {
+	o.asserts = append(o.asserts, x)
+}
+
+// AssertSoft は重み weight のソフト制約を目的関数 id に登録する。
+func (o *Optimize) AssertSoft(x *AST, weight int64, id string) {
+	if _, ok := o.softs[id]; !ok {
+		o.ids = append(o.ids, id)
+	}
+	o.softs[id] = append(o.softs[id], x.Ite(Int64(o.ctx, 0), Int64(o.ctx, weight)))
+}
+
+// SetTimeout は Check の制限時間をミリ秒単位で設定する。
+func (o *Optimize) SetTimeout(ms uint) {
+	o.timeout = ms
+}
+
+// Check は制約を満たし、目的関数を登録された順に最小化するモデルを求める。
+func (o *Optimize) Check() (r LBool) {
+	atomic.StoreInt32(&o.ctx.interrupted, 0)
+	var deadline time.Time
+	if o.timeout > 0 {
+		deadline = time.Now().Add(time.Duration(o.timeout) * time.Millisecond)
+	}
+	o.stats = map[string]float64{}
+	asserts := append([]*AST{}, o.asserts...)
+	r = o.search(asserts, deadline)
+	if r != True {
+		return
+	}
+	for _, id := range o.ids {
+		penalty := Int64(o.ctx, 0).Add(o.softs[id]...)
+
+		// 重みの総和が lo 未満のモデルは存在せず、hi のモデルは存在する
+		lo, hi := int64(0), eval(penalty, o.model)
+		best := o.model
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			switch o.search(append(asserts, penalty.Le(Int64(o.ctx, mid))), deadline) {
+			case True:
+				best, hi = o.model, eval(penalty, o.model)
+			case False:
+				lo = mid + 1
+			default:
+				o.model = best
+				return Undef
+			}
+		}
+		o.model = best
+		asserts = append(asserts, penalty.Le(Int64(o.ctx, hi)))
+	}
+	return
+}
+
+// search は期限までに制約を満たすモデルを探し、見つかった場合は model に記録する。
+func (o *Optimize) search(asserts []*AST, deadline time.Time) (r LBool) {
+	var timeout uint
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining <= 0 {
+			o.reason = "timeout"
+			return Undef
+		}
+		timeout = uint(remaining)
+	}
+	r, model, st := search(o.ctx, asserts, timeout)
+	for key, value := range st.values() {
+		o.stats[key] += value
+	}
+	o.reason = st.reason
+	if r == True {
+		o.model = model
+	}
+	return
+}
+
+// Model は最後の Check で得られたモデルを返す。
+func (o *Optimize) Model() *Model {
+	if o.model == nil {
+		return nil
+	}
+	return &Model{values: o.model, asserts: o.asserts}
+}
+
+// ReasonUnknown は最後の Check の結果が Undef となった理由を返す。
+func (o *Optimize) ReasonUnknown() string {
+	return o.reason
+}
+
+// Statistics は最後の Check の統計情報を返す。
+func (o *Optimize) Statistics() map[string]float64 {
+	return o.stats
+}
@@ -0,0 +1,179 @@
+//go:build !cgo && fakez3
+
+// 偽のバックエンドの SMT-LIB 2 の読み込み
+// declare-const、引数のない declare-fun および assert のみを扱い、
+// set-logic や check-sat などのその他のコマンドは読み飛ばす。
+
+package z3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sexpr は S 式。アトムの場合は list が nil となる。
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+// fakeOps は SMT-LIB の演算子と結果のソート。
+var fakeOps = map[string]*Sort{
+	"+": intSort, "-": intSort, "*": intSort, "ite": nil,
+	"and": boolSort, "or": boolSort, "not": boolSort, "xor": boolSort, "=>": boolSort,
+	"=": boolSort, "<": boolSort, "<=": boolSort, ">": boolSort, ">=": boolSort, "distinct": boolSort,
+}
+
+// ParseSMTLIB2 は SMT-LIB 2 の文字列を読み込み、その中の assert の制約のリストを返す。
+func ParseSMTLIB2(ctx *Context, src string) (asserts []*AST, err error) {
+	cmds, err := parseSexprs(src)
+	if err != nil {
+		return
+	}
+	consts := map[string]*AST{}
+	for _, cmd := range cmds {
+		if len(cmd.list) == 0 || cmd.list[0].list != nil {
+			err = fmt.Errorf("invalid command")
+			return
+		}
+		args := cmd.list[1:]
+		switch cmd.list[0].atom {
+		case "declare-const", "declare-fun":
+			if cmd.list[0].atom == "declare-fun" {
+				if len(args) != 3 || args[1].list == nil || len(args[1].list) != 0 {
+					err = fmt.Errorf("declare-fun with arguments is not supported")
+					return
+				}
+				args = []*sexpr{args[0], args[2]}
+			}
+			if len(args) != 2 {
+				err = fmt.Errorf("invalid declaration")
+				return
+			}
+			var sort *Sort
+			switch args[1].atom {
+			case "Int":
+				sort = intSort
+			case "Bool":
+				sort = boolSort
+			default:
+				err = fmt.Errorf("unknown sort %s", args[1].atom)
+				return
+			}
+			consts[args[0].atom] = &AST{op: "const", name: args[0].atom, sort: sort}
+		case "assert":
+			if len(args) != 1 {
+				err = fmt.Errorf("invalid assert command")
+				return
+			}
+			var x *AST
+			if x, err = smtlibTerm(args[0], consts); err != nil {
+				return
+			}
+			asserts = append(asserts, x)
+		}
+	}
+	return
+}
+
+// smtlibTerm は S 式の項を AST に変換する。
+func smtlibTerm(e *sexpr, consts map[string]*AST) (x *AST, err error) {
+	if e.list == nil {
+		switch {
+		case e.atom == "true" || e.atom == "false":
+			x = &AST{op: e.atom, sort: boolSort}
+		case consts[e.atom] != nil:
+			x = consts[e.atom]
+		default:
+			var v int64
+			if v, err = strconv.ParseInt(e.atom, 10, 64); err != nil {
+				err = fmt.Errorf("unknown constant %s", e.atom)
+				return
+			}
+			x = &AST{op: "num", val: v, sort: intSort}
+		}
+		return
+	}
+	if len(e.list) < 2 || e.list[0].list != nil {
+		err = fmt.Errorf("invalid term")
+		return
+	}
+	name := e.list[0].atom
+	sort, ok := fakeOps[name]
+	if !ok {
+		err = fmt.Errorf("unknown function %s", name)
+		return
+	}
+	var args []*AST
+	for _, a := range e.list[1:] {
+		var y *AST
+		if y, err = smtlibTerm(a, consts); err != nil {
+			return
+		}
+		args = append(args, y)
+	}
+	switch {
+	case name == "ite":
+		if len(args) != 3 {
+			err = fmt.Errorf("invalid ite")
+			return
+		}
+		sort = args[1].sort
+	case name == "-" && len(args) == 1:
+		// 単項のマイナス
+		if args[0].op == "num" {
+			x = &AST{op: "num", val: -args[0].val, sort: intSort}
+			return
+		}
+		args = append([]*AST{{op: "num", sort: intSort}}, args...)
+	}
+	x = op(name, sort, args...)
+	return
+}
+
+// parseSexprs は文字列を S 式の並びに分解する。
+func parseSexprs(src string) (es []*sexpr, err error) {
+	stack := [][]*sexpr{nil}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == '(':
+			stack = append(stack, []*sexpr{})
+		case c == ')':
+			if len(stack) < 2 {
+				err = fmt.Errorf("unexpected )")
+				return
+			}
+			e := &sexpr{list: stack[len(stack)-1]}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], e)
+		case c == '|':
+			j := strings.IndexByte(src[i+1:], '|')
+			if j < 0 {
+				err = fmt.Errorf("unterminated symbol")
+				return
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], &sexpr{atom: src[i+1 : i+1+j]})
+			i += j + 1
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n();|", rune(src[j])) {
+				j++
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], &sexpr{atom: src[i:j]})
+			i = j - 1
+		}
+	}
+	if len(stack) != 1 {
+		err = fmt.Errorf("unexpected end of input")
+		return
+	}
+	es = stack[0]
+	return
+}
@@ -0,0 +1,557 @@
+//go:build !cgo && fakez3
+
+// 偽のバックエンドの解決と Z3 の API の補い
+// 変数に順に値を割り当て、割り当てが済んだ変数のみを含む制約を評価して
+// 違反すれば戻る (バックトラック) 総当たりで解を探す。
+// 解がないと言えるのは、すべての int の変数の値が x >= 1 のような定数との比較で
+// 狭い範囲に限られ、その範囲を調べ尽くした場合のみで、それ以外は Undef とする。
+
+package z3
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 偽のバックエンドで int の変数が取る値の範囲。
+// 定数との比較で範囲が限られていない変数はこの範囲のみを探す。
+const (
+	fakeIntMin = -32
+	fakeIntMax = 32
+)
+
+// fakeMaxDomain は調べ尽くす int の変数の値の範囲の幅の上限。
+const fakeMaxDomain = fakeIntMax - fakeIntMin
+
+// searchState は解の探索の状態。
+type searchState struct {
+	ctx       *Context
+	deadline  time.Time // 打ち切る時刻 (ゼロ値の場合は無制限)
+	decisions int       // 変数に値を割り当てた回数
+	conflicts int       // 制約に違反した回数
+	reason    string    // 打ち切った理由
+}
+
+// values は探索の統計情報を返す。
+func (st *searchState) values() map[string]float64 {
+	return map[string]float64{
+		"decisions": float64(st.decisions),
+		"conflicts": float64(st.conflicts),
+	}
+}
+
+// stopped は探索を打ち切るかどうかを判定する。
+func (st *searchState) stopped() bool {
+	if atomic.LoadInt32(&st.ctx.interrupted) != 0 {
+		st.reason = "canceled"
+		return true
+	}
+	if !st.deadline.IsZero() && st.decisions%256 == 0 && time.Now().After(st.deadline) {
+		st.reason = "timeout"
+		return true
+	}
+	return false
+}
+
+// search は制約をすべて満たす定数の値を探す。
+// timeout はミリ秒単位の制限時間で、0 の場合は無制限とする。
+func search(ctx *Context, asserts []*AST, timeout uint) (r LBool, model map[string]int64, st *searchState) {
+	st = &searchState{ctx: ctx}
+	if timeout > 0 {
+		st.deadline = time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+
+	// 制約を論理積で分け、含まれる最後の定数の割り当てで評価する
+	consts := constsOf(asserts)
+	index := map[string]int{}
+	for i, c := range consts {
+		index[c.name] = i
+	}
+	var conjuncts []*AST
+	for _, a := range asserts {
+		conjuncts = append(conjuncts, splitAnd(a)...)
+	}
+	checks := make([][]*AST, len(consts))
+	model = map[string]int64{}
+	for _, a := range conjuncts {
+		last := -1
+		for _, c := range constsOf([]*AST{a}) {
+			if i := index[c.name]; i > last {
+				last = i
+			}
+		}
+		if last < 0 {
+			if eval(a, model) == 0 {
+				r = False
+				return
+			}
+			continue
+		}
+		checks[last] = append(checks[last], a)
+	}
+
+	// 定数ごとの値の候補 (範囲の中で 0, 1, -1, 2, -2, ... の順)。
+	// 範囲が限られていない int の定数がある場合、探索は網羅的でない
+	bounds := boundsOf(conjuncts)
+	complete := true
+	domains := make([][]int64, len(consts))
+	for i, c := range consts {
+		if c.sort == boolSort {
+			domains[i] = []int64{0, 1}
+			continue
+		}
+		b := bounds[c.name]
+		lo, hi := b.lo, b.hi
+		if !b.hasLo || !b.hasHi || (lo <= hi && uint64(hi-lo) > fakeMaxDomain) {
+			complete = false
+			if !b.hasLo || lo < fakeIntMin {
+				lo = fakeIntMin
+			}
+			if !b.hasHi || hi > fakeIntMax {
+				hi = fakeIntMax
+			}
+		}
+		for v := lo; v <= hi; v++ {
+			domains[i] = append(domains[i], v)
+			if v == hi {
+				break
+			}
+		}
+		sort.Slice(domains[i], func(j, k int) bool {
+			x, y := domains[i][j], domains[i][k]
+			if abs64(x) != abs64(y) {
+				return abs64(x) < abs64(y)
+			}
+			return x > y
+		})
+	}
+
+	var assign func(i int) bool
+	assign = func(i int) bool {
+		if i == len(consts) {
+			return true
+		}
+		name := consts[i].name
+	next:
+		for _, v := range domains[i] {
+			st.decisions++
+			if st.stopped() {
+				return false
+			}
+			model[name] = v
+			for _, a := range checks[i] {
+				if eval(a, model) == 0 {
+					st.conflicts++
+					continue next
+				}
+			}
+			if assign(i + 1) {
+				return true
+			}
+			if st.reason != "" {
+				return false
+			}
+		}
+		delete(model, name)
+		return false
+	}
+	switch {
+	case assign(0):
+		r = True
+	case st.reason != "":
+		r, model = Undef, nil
+	case !complete:
+		r, model = Undef, nil
+		st.reason = "incomplete"
+	default:
+		r, model = False, nil
+	}
+	return
+}
+
+// bound は int の定数の値の範囲。
+type bound struct {
+	lo, hi       int64
+	hasLo, hasHi bool
+}
+
+// boundsOf は x < 3 や 1 <= x のような定数と数値の比較の項から、各定数の値の範囲を求める。
+func boundsOf(conjuncts []*AST) map[string]bound {
+	bounds := map[string]bound{}
+	for _, a := range conjuncts {
+		if len(a.args) != 2 {
+			continue
+		}
+		op, x, y := a.op, a.args[0], a.args[1]
+		if x.op == "num" && y.op == "const" {
+			// 1 <= x は x >= 1 とする
+			x, y = y, x
+			switch op {
+			case "<":
+				op = ">"
+			case "<=":
+				op = ">="
+			case ">":
+				op = "<"
+			case ">=":
+				op = "<="
+			}
+		}
+		if x.op != "const" || x.sort != intSort || y.op != "num" {
+			continue
+		}
+		b, v := bounds[x.name], y.val
+		lower := func(v int64) {
+			if !b.hasLo || v > b.lo {
+				b.lo, b.hasLo = v, true
+			}
+		}
+		upper := func(v int64) {
+			if !b.hasHi || v < b.hi {
+				b.hi, b.hasHi = v, true
+			}
+		}
+		switch op {
+		case "=":
+			lower(v)
+			upper(v)
+		case "<":
+			if v > math.MinInt64 {
+				upper(v - 1)
+			}
+		case "<=":
+			upper(v)
+		case ">":
+			if v < math.MaxInt64 {
+				lower(v + 1)
+			}
+		case ">=":
+			lower(v)
+		}
+		bounds[x.name] = b
+	}
+	return bounds
+}
+
+// abs64 は v の絶対値を返す。
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// splitAnd は論理積の式をそれぞれの項に分ける。
+func splitAnd(a *AST) (r []*AST) {
+	if a.op != "and" {
+		return []*AST{a}
+	}
+	for _, x := range a.args {
+		r = append(r, splitAnd(x)...)
+	}
+	return
+}
+
+// constsOf は式に含まれる定数を現れる順に返す。
+func constsOf(xs []*AST) (consts []*AST) {
+	seen := map[string]bool{}
+	var walk func(a *AST)
+	walk = func(a *AST) {
+		if a.op == "const" {
+			if !seen[a.name] {
+				seen[a.name] = true
+				consts = append(consts, a)
+			}
+			return
+		}
+		for _, x := range a.args {
+			walk(x)
+		}
+	}
+	for _, x := range xs {
+		walk(x)
+	}
+	return
+}
+
+// eval は定数の値の表で式の値を求める。bool の値は 1 (真) と 0 (偽) で表す。
+// 表にない定数の値は 0 とする。
+func eval(a *AST, m map[string]int64) (v int64) {
+	switch a.op {
+	case "const":
+		return m[a.name]
+	case "num":
+		return a.val
+	case "true":
+		return 1
+	case "false":
+		return 0
+	case "ite":
+		if eval(a.args[0], m) != 0 {
+			return eval(a.args[1], m)
+		}
+		return eval(a.args[2], m)
+	}
+	vs := make([]int64, len(a.args))
+	for i, x := range a.args {
+		vs[i] = eval(x, m)
+	}
+	b := func(ok bool) int64 {
+		if ok {
+			return 1
+		}
+		return 0
+	}
+	switch a.op {
+	case "+":
+		for _, x := range vs {
+			v += x
+		}
+	case "-":
+		v = vs[0]
+		for _, x := range vs[1:] {
+			v -= x
+		}
+	case "*":
+		v = 1
+		for _, x := range vs {
+			v *= x
+		}
+	case "and":
+		v = 1
+		for _, x := range vs {
+			v &= b(x != 0)
+		}
+	case "or":
+		for _, x := range vs {
+			v |= b(x != 0)
+		}
+	case "not":
+		v = b(vs[0] == 0)
+	case "xor":
+		v = b((vs[0] != 0) != (vs[1] != 0))
+	case "=>":
+		v = b(vs[0] == 0 || vs[1] != 0)
+	case "=":
+		v = b(vs[0] == vs[1])
+	case "<":
+		v = b(vs[0] < vs[1])
+	case "<=":
+		v = b(vs[0] <= vs[1])
+	case ">":
+		v = b(vs[0] > vs[1])
+	case ">=":
+		v = b(vs[0] >= vs[1])
+	case "distinct":
+		v = 1
+		for i := range vs {
+			for j := i + 1; j < len(vs); j++ {
+				if vs[i] == vs[j] {
+					v = 0
+				}
+			}
+		}
+	case "at-most", "at-least":
+		var n int64
+		for _, x := range vs {
+			n += b(x != 0)
+		}
+		if a.op == "at-most" {
+			v = b(n <= a.params[0])
+		} else {
+			v = b(n >= a.params[0])
+		}
+	case "pble", "pbge", "pbeq":
+		var sum int64
+		for i, x := range vs {
+			if x != 0 {
+				sum += a.params[i+1]
+			}
+		}
+		switch a.op {
+		case "pble":
+			v = b(sum <= a.params[0])
+		case "pbge":
+			v = b(sum >= a.params[0])
+		default:
+			v = b(sum == a.params[0])
+		}
+	default:
+		panic("fake z3: unknown operator " + a.op)
+	}
+	return
+}
+
+// pb は基数制約・擬似ブール制約の AST を作成する。
+func pb(name string, bs []*AST, params ...int64) *AST {
+	return &AST{op: name, sort: boolSort, args: bs, params: params}
+}
+
+// AtMost は bs のうち真であるものが k 個以下であるという制約を作成する。
+func AtMost(ctx *Context, bs []*AST, k uint) *AST {
+	return pb("at-most", bs, int64(k))
+}
+
+// AtLeast は bs のうち真であるものが k 個以上であるという制約を作成する。
+func AtLeast(ctx *Context, bs []*AST, k uint) *AST {
+	return pb("at-least", bs, int64(k))
+}
+
+// pbParams は k と重みを並べる。
+func pbParams(coeffs []int32, k int32) (params []int64) {
+	params = append(params, int64(k))
+	for _, c := range coeffs {
+		params = append(params, int64(c))
+	}
+	return
+}
+
+// PbLe は真である bs[i] の重み coeffs[i] の総和が k 以下であるという制約を作成する。
+func PbLe(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	return pb("pble", bs, pbParams(coeffs, k)...)
+}
+
+// PbGe は真である bs[i] の重み coeffs[i] の総和が k 以上であるという制約を作成する。
+func PbGe(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	return pb("pbge", bs, pbParams(coeffs, k)...)
+}
+
+// PbEq は真である bs[i] の重み coeffs[i] の総和が k に等しいという制約を作成する。
+func PbEq(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	return pb("pbeq", bs, pbParams(coeffs, k)...)
+}
+
+// fakeSolverParams は偽のバックエンドが受け付けるソルバーのパラメータとその種類。
+// Z3 のパラメータの一部のみとする。
+var fakeSolverParams = map[string]string{
+	"timeout":      "uint",
+	"rlimit":       "uint",
+	"random_seed":  "uint",
+	"max_memory":   "uint",
+	"auto_config":  "bool",
+	"unsat_core":   "bool",
+	"model":        "bool",
+	"arith.solver": "uint",
+}
+
+// SetSolverParam はソルバーにパラメータを設定する。
+// smt. などのモジュール名の接頭辞は取り除いて設定する。
+func SetSolverParam(ctx *Context, s *Solver, key, value string) (err error) {
+	name, kind := key, fakeSolverParams[key]
+	if kind == "" {
+		if i := strings.Index(key, "."); i > 0 {
+			name = key[i+1:]
+			kind = fakeSolverParams[name]
+		}
+	}
+	switch kind {
+	case "":
+		err = fmt.Errorf("%s is unknown parameter", key)
+		return
+	case "uint":
+		if _, err = strconv.ParseUint(value, 10, 32); err != nil {
+			err = fmt.Errorf("value of %s must be unsigned integer", key)
+			return
+		}
+	case "bool":
+		if value != "true" && value != "false" {
+			err = fmt.Errorf("value of %s must be true or false", key)
+			return
+		}
+	}
+	s.params[name] = value
+	return
+}
+
+// CheckSolverParam はソルバーのパラメータの名前と値が正しいかどうかをチェックする。
+func CheckSolverParam(key, value string) (err error) {
+	ctx := NewContext(NewConfig())
+	err = SetSolverParam(ctx, ctx.NewSolver(), key, value)
+	return
+}
+
+// ReasonUnknown は最後の Check の結果が Undef となった理由を返す。
+func ReasonUnknown(ctx *Context, s *Solver) string {
+	return s.reason
+}
+
+// MaxMemoryLimit は SetMemoryLimit で設定できるメモリの上限の最大値 (メガバイト)。
+const MaxMemoryLimit = 4095
+
+// SetMemoryLimit は偽のバックエンドでは何もしない。
+func SetMemoryLimit(megabytes uint) {
+}
+
+// Interrupt はコンテクストで実行中の Check を中断する。
+func Interrupt(ctx *Context) {
+	atomic.StoreInt32(&ctx.interrupted, 1)
+}
+
+// fakeLogics は偽のバックエンドが受け付けるロジック。
+var fakeLogics = []string{"ALL", "LIA", "NIA", "QF_FD", "QF_IDL", "QF_LIA", "QF_NIA", "QF_UF", "QF_UFLIA"}
+
+// NewSolverForLogic はロジックを指定したソルバーを作成する。
+// 偽のバックエンドではロジックによる違いはない。
+func NewSolverForLogic(ctx *Context, logic string) *Solver {
+	return ctx.NewSolver()
+}
+
+// CheckLogic はロジックの名前が使用できるかどうかをチェックする。
+func CheckLogic(logic string) (err error) {
+	for _, name := range fakeLogics {
+		if name == logic {
+			return
+		}
+	}
+	err = fmt.Errorf("%s is unknown logic", logic)
+	return
+}
+
+// Tactics は使用できるタクティクの名前のリストを返す。
+func Tactics() []string {
+	return []string{"ctx-simplify", "elim-uncnstr", "propagate-values", "qflia", "qfnia", "sat", "simplify", "smt", "solve-eqs"}
+}
+
+// CheckTactics はタクティクの名前がすべて使用できるかどうかをチェックする。
+func CheckTactics(names []string) (err error) {
+	known := map[string]bool{}
+	for _, name := range Tactics() {
+		known[name] = true
+	}
+	if len(names) == 0 {
+		err = fmt.Errorf("tactic is empty")
+		return
+	}
+	for _, name := range names {
+		if !known[name] {
+			err = fmt.Errorf("%s is unknown tactic", name)
+			return
+		}
+	}
+	return
+}
+
+// NewSolverFromTactics はタクティクを指定したソルバーを作成する。
+// 偽のバックエンドではタクティクによる違いはない。
+func NewSolverFromTactics(ctx *Context, names []string) *Solver {
+	return ctx.NewSolver()
+}
+
+// Statistics はソルバーの最後の Check の統計情報 (decisions と conflicts) を返す。
+func Statistics(ctx *Context, s *Solver) map[string]float64 {
+	stats := map[string]float64{}
+	for k, v := range s.stats {
+		stats[k] = v
+	}
+	return stats
+}
+
+// Int64 は int64 の値の int の数値を作成する。
+func Int64(ctx *Context, v int64) *AST {
+	return &AST{op: "num", val: v, sort: intSort}
+}
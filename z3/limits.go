@@ -0,0 +1,45 @@
+//go:build cgo
+
+// 解決の制限と中断、結果が不明となった理由
+// go-z3 は Z3_solver_get_reason_unknown、グローバルパラメータの設定および
+// Z3_interrupt を提供していないため、ここで補う。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+import "C"
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// ReasonUnknown は最後の Check の結果が Undef となった理由を返す。
+// Z3 が返す "timeout"、"canceled"、"out of memory" などの文字列となる。
+func ReasonUnknown(ctx *Context, s *Solver) string {
+	return C.GoString(C.Z3_solver_get_reason_unknown(contextHandle(ctx), solverHandle(s)))
+}
+
+// MaxMemoryLimit は SetMemoryLimit で設定できるメモリの上限の最大値 (メガバイト)。
+const MaxMemoryLimit = 4095
+
+// SetMemoryLimit は Z3 が使用するメモリの上限をメガバイト単位で設定する。
+// グローバルパラメータ memory_high_watermark (バイト単位) であるため、
+// プロセス内のすべてのコンテクストに適用される。上限を超えた Check は
+// 打ち切られ、結果は Undef、理由は memout となる。
+// memory_max_size は上限を超えると Z3 の例外でプロセスが異常終了するため使用しない。
+func SetMemoryLimit(megabytes uint) {
+	bytes := uint64(megabytes) << 20
+	key, value := C.CString("memory_high_watermark"), C.CString(strconv.FormatUint(bytes, 10))
+	defer C.free(unsafe.Pointer(key))
+	defer C.free(unsafe.Pointer(value))
+	C.Z3_global_param_set(key, value)
+}
+
+// Interrupt はコンテクストで実行中の Check を中断する。
+// 他のゴルーチンから呼び出すことができ、中断された Check の結果は Undef、
+// 理由は canceled となる。
+func Interrupt(ctx *Context) {
+	C.Z3_interrupt(contextHandle(ctx))
+}
@@ -0,0 +1,10 @@
+//go:build !cgo && !fakez3
+
+// cgo を使用しないビルドの禁止
+// smtrun は Z3 を cgo で呼び出すため、cgo が無効な場合はビルドできない。
+// 偽のバックエンドはテスト専用であり、go test -tags fakez3 でのみ使用する。
+
+package z3
+
+// cgo が無効な場合にここでビルドを失敗させる。CGO_ENABLED=1 でビルドすること。
+var _ = smtrun_requires_cgo_or_fakez3_tag_for_tests
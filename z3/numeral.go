@@ -0,0 +1,24 @@
+//go:build cgo
+
+// 整数の数値
+// go-z3 の Context.Int は C の int (32 ビット) で値を受け取るため、
+// それを超える値は Z3_mk_numeral で 10 進数の文字列から作成する。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+import "C"
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// Int64 は int64 の値の int の数値を作成する。
+func Int64(ctx *Context, v int64) *AST {
+	c := contextHandle(ctx)
+	cs := C.CString(strconv.FormatInt(v, 10))
+	defer C.free(unsafe.Pointer(cs))
+	return newAST(c, C.Z3_mk_numeral(c, cs, C.Z3_mk_int_sort(c)))
+}
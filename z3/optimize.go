@@ -0,0 +1,97 @@
+//go:build cgo
+
+// ソフト制約の最適化 (MaxSMT)
+// go-z3 は Z3 の Optimize を提供していないため、Z3_mk_optimize、
+// Z3_optimize_assert_soft、Z3_optimize_check などをここで補う。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+//
+// /* 仮定なしで解決する */
+// static Z3_lbool optimize_check(Z3_context c, Z3_optimize o) {
+//     return Z3_optimize_check(c, o, 0, NULL);
+// }
+import "C"
+
+import (
+	"strconv"
+	"unsafe"
+)
+
+// Optimize は Z3 の Optimize。
+// 同じ id のソフト制約は一つの目的関数 (違反した制約の重みの総和) となり、
+// 目的関数は最初に登録された順に辞書式に最小化される。
+type Optimize struct {
+	rawCtx      C.Z3_context
+	rawOptimize C.Z3_optimize
+}
+
+// rawModel は go-z3 の Model と同じ配置の構造体。
+type rawModel struct {
+	rawCtx   C.Z3_context
+	rawModel C.Z3_model
+}
+
+// NewOptimize は Optimize を作成する。
+func NewOptimize(ctx *Context) *Optimize {
+	c := contextHandle(ctx)
+	o := C.Z3_mk_optimize(c)
+	C.Z3_optimize_inc_ref(c, o)
+	return &Optimize{rawCtx: c, rawOptimize: o}
+}
+
+// Close は Optimize を解放する。
+func (o *Optimize) Close() error {
+	C.Z3_optimize_dec_ref(o.rawCtx, o.rawOptimize)
+	return nil
+}
+
+// Assert は制約を登録する。
+func (o *Optimize) Assert(x *AST) {
+	C.Z3_optimize_assert(o.rawCtx, o.rawOptimize, astHandle(x))
+}
+
+// AssertSoft は重み weight のソフト制約を目的関数 id に登録する。
+func (o *Optimize) AssertSoft(x *AST, weight int64, id string) {
+	w := C.CString(strconv.FormatInt(weight, 10))
+	defer C.free(unsafe.Pointer(w))
+	C.Z3_optimize_assert_soft(o.rawCtx, o.rawOptimize, astHandle(x), w, symbol(o.rawCtx, id))
+}
+
+// SetTimeout は Check の制限時間をミリ秒単位で設定する。
+func (o *Optimize) SetTimeout(ms uint) {
+	params := C.Z3_mk_params(o.rawCtx)
+	C.Z3_params_inc_ref(o.rawCtx, params)
+	defer C.Z3_params_dec_ref(o.rawCtx, params)
+	C.Z3_params_set_uint(o.rawCtx, params, symbol(o.rawCtx, "timeout"), C.uint(ms))
+	C.Z3_optimize_set_params(o.rawCtx, o.rawOptimize, params)
+}
+
+// Check は制約を満たし、目的関数を最小化するモデルを求める。
+// 制限時間を過ぎた場合などは Undef となる。
+func (o *Optimize) Check() LBool {
+	return LBool(C.optimize_check(o.rawCtx, o.rawOptimize))
+}
+
+// Model は最後の Check で得られたモデルを返す。
+// go-z3 の Model の Close で参照カウントを減らすため、ここで増やしておく。
+func (o *Optimize) Model() *Model {
+	m := C.Z3_optimize_get_model(o.rawCtx, o.rawOptimize)
+	if m == nil {
+		return nil
+	}
+	C.Z3_model_inc_ref(o.rawCtx, m)
+	return (*Model)(unsafe.Pointer(&rawModel{rawCtx: o.rawCtx, rawModel: m}))
+}
+
+// ReasonUnknown は最後の Check の結果が Undef となった理由を返す。
+func (o *Optimize) ReasonUnknown() string {
+	return C.GoString(C.Z3_optimize_get_reason_unknown(o.rawCtx, o.rawOptimize))
+}
+
+// Statistics は最後の Check の統計情報を返す。
+func (o *Optimize) Statistics() map[string]float64 {
+	return statsMap(o.rawCtx, C.Z3_optimize_get_statistics(o.rawCtx, o.rawOptimize))
+}
@@ -0,0 +1,112 @@
+//go:build cgo
+
+// ソルバーのパラメータ
+// go-z3 はコンテクストのパラメータ (Z3_set_param_value) のみを提供しているため、
+// ソルバーごとのパラメータ (Z3_solver_set_params) をここで補う。
+// smt.random_seed のようなモジュールのパラメータもソルバーごとに設定できる。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+//
+// /* Z3_bool は Z3 の版によって int もしくは bool となるため int で受け渡す */
+// static void params_set_bool(Z3_context c, Z3_params p, Z3_symbol k, int v) {
+//     Z3_params_set_bool(c, p, k, v != 0);
+// }
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// rawSolver は go-z3 の Solver と同じ配置の構造体。
+type rawSolver struct {
+	rawCtx    C.Z3_context
+	rawSolver C.Z3_solver
+}
+
+// solverHandle はソルバーの Z3_solver を返す。
+func solverHandle(s *Solver) C.Z3_solver {
+	return (*rawSolver)(unsafe.Pointer(s)).rawSolver
+}
+
+// symbol は文字列から Z3 のシンボルを作成する。
+func symbol(ctx C.Z3_context, name string) C.Z3_symbol {
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	return C.Z3_mk_string_symbol(ctx, cs)
+}
+
+// SetSolverParam はソルバーにパラメータを設定する。
+// パラメータの名前と値はソルバーのパラメータの記述 (Z3_solver_get_param_descrs) で
+// チェックし、不正な場合は設定せずにエラーを返す。
+// smt. などのモジュール名の接頭辞は、ソルバーの記述に従って取り除いて設定する。
+func SetSolverParam(ctx *Context, s *Solver, key, value string) (err error) {
+	c, rs := contextHandle(ctx), solverHandle(s)
+	descrs := C.Z3_solver_get_param_descrs(c, rs)
+	C.Z3_param_descrs_inc_ref(c, descrs)
+	defer C.Z3_param_descrs_dec_ref(c, descrs)
+
+	name, kind := key, C.Z3_param_descrs_get_kind(c, descrs, symbol(c, key))
+	if kind == C.Z3_PK_INVALID {
+		if i := strings.Index(key, "."); i > 0 {
+			name = key[i+1:]
+			kind = C.Z3_param_descrs_get_kind(c, descrs, symbol(c, name))
+		}
+	}
+	if kind == C.Z3_PK_INVALID {
+		err = fmt.Errorf("%s is unknown parameter", key)
+		return
+	}
+
+	params := C.Z3_mk_params(c)
+	C.Z3_params_inc_ref(c, params)
+	defer C.Z3_params_dec_ref(c, params)
+	sym := symbol(c, name)
+	switch kind {
+	case C.Z3_PK_UINT:
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, 32); err != nil {
+			err = fmt.Errorf("value of %s must be unsigned integer", key)
+			return
+		}
+		C.Z3_params_set_uint(c, params, sym, C.uint(n))
+	case C.Z3_PK_BOOL:
+		if value != "true" && value != "false" {
+			err = fmt.Errorf("value of %s must be true or false", key)
+			return
+		}
+		var v C.int
+		if value == "true" {
+			v = 1
+		}
+		C.params_set_bool(c, params, sym, v)
+	case C.Z3_PK_DOUBLE:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err != nil {
+			err = fmt.Errorf("value of %s must be number", key)
+			return
+		}
+		C.Z3_params_set_double(c, params, sym, C.double(f))
+	default:
+		C.Z3_params_set_symbol(c, params, sym, symbol(c, value))
+	}
+	C.Z3_solver_set_params(c, rs, params)
+	return
+}
+
+// CheckSolverParam はソルバーのパラメータの名前と値が正しいかどうかをチェックする。
+func CheckSolverParam(key, value string) (err error) {
+	config := NewConfig()
+	ctx := NewContext(config)
+	config.Close()
+	defer ctx.Close()
+	s := ctx.NewSolver()
+	defer s.Close()
+	err = SetSolverParam(ctx, s, key, value)
+	return
+}
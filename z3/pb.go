@@ -0,0 +1,48 @@
+//go:build cgo
+
+// 基数制約と擬似ブール制約
+// Z3 のネイティブな制約 (Z3_mk_atmost、Z3_mk_pble など) を作成する。
+// 算術の和との比較に展開しないため、Z3 は専用の推論を使用できる。
+
+package z3
+
+// #include <z3.h>
+import "C"
+
+// AtMost は bs のうち真であるものが k 個以下であるという制約を作成する。
+func AtMost(ctx *Context, bs []*AST, k uint) *AST {
+	c, args := contextHandle(ctx), astHandles(bs)
+	return newAST(c, C.Z3_mk_atmost(c, C.uint(len(args)), &args[0], C.uint(k)))
+}
+
+// AtLeast は bs のうち真であるものが k 個以上であるという制約を作成する。
+func AtLeast(ctx *Context, bs []*AST, k uint) *AST {
+	c, args := contextHandle(ctx), astHandles(bs)
+	return newAST(c, C.Z3_mk_atleast(c, C.uint(len(args)), &args[0], C.uint(k)))
+}
+
+// PbLe は真である bs[i] の重み coeffs[i] の総和が k 以下であるという制約を作成する。
+func PbLe(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	c, args, ws := contextHandle(ctx), astHandles(bs), cInts(coeffs)
+	return newAST(c, C.Z3_mk_pble(c, C.uint(len(args)), &args[0], &ws[0], C.int(k)))
+}
+
+// PbGe は真である bs[i] の重み coeffs[i] の総和が k 以上であるという制約を作成する。
+func PbGe(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	c, args, ws := contextHandle(ctx), astHandles(bs), cInts(coeffs)
+	return newAST(c, C.Z3_mk_pbge(c, C.uint(len(args)), &args[0], &ws[0], C.int(k)))
+}
+
+// PbEq は真である bs[i] の重み coeffs[i] の総和が k に等しいという制約を作成する。
+func PbEq(ctx *Context, bs []*AST, coeffs []int32, k int32) *AST {
+	c, args, ws := contextHandle(ctx), astHandles(bs), cInts(coeffs)
+	return newAST(c, C.Z3_mk_pbeq(c, C.uint(len(args)), &args[0], &ws[0], C.int(k)))
+}
+
+// cInts は整数のリストを C の int の配列に変換する。
+func cInts(xs []int32) (r []C.int) {
+	for _, x := range xs {
+		r = append(r, C.int(x))
+	}
+	return
+}
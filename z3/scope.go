@@ -0,0 +1,19 @@
+//go:build cgo
+
+// ソルバーのスコープ
+// go-z3 は Z3_solver_push と Z3_solver_pop を提供していないため、ここで補う。
+
+package z3
+
+// #include <z3.h>
+import "C"
+
+// Push はソルバーに新しいスコープを作成する。
+func Push(ctx *Context, s *Solver) {
+	C.Z3_solver_push(contextHandle(ctx), solverHandle(s))
+}
+
+// Pop はソルバーのスコープを n 個取り除き、その中で登録された制約を取り除く。
+func Pop(ctx *Context, s *Solver, n uint) {
+	C.Z3_solver_pop(contextHandle(ctx), solverHandle(s), C.uint(n))
+}
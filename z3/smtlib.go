@@ -0,0 +1,39 @@
+//go:build cgo
+
+// SMT-LIB 2 の読み込み
+// go-z3 は Z3_parse_smtlib2_string を提供していないため、ここで補う。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// ParseSMTLIB2 は SMT-LIB 2 の文字列を読み込み、その中の assert の制約のリストを返す。
+// declare-const などで宣言された定数はコンテクストに作成される。
+// Z3 の既定のエラーハンドラーは不正な記述でプロセスを終了させるため、
+// コンテクストのエラーハンドラーを外して読み込む。外したエラーハンドラーは元に戻さないため、
+// SMT-LIB の解決のために作成したコンテクストで使用すること。
+func ParseSMTLIB2(ctx *Context, src string) (asserts []*AST, err error) {
+	c := contextHandle(ctx)
+	C.Z3_set_error_handler(c, nil)
+	cs := C.CString(src)
+	defer C.free(unsafe.Pointer(cs))
+	v := C.Z3_parse_smtlib2_string(c, cs, 0, nil, nil, 0, nil, nil)
+	if code := C.Z3_get_error_code(c); code != C.Z3_OK {
+		err = fmt.Errorf("%s", C.GoString(C.Z3_get_error_msg(c, code)))
+		return
+	}
+	C.Z3_ast_vector_inc_ref(c, v)
+	defer C.Z3_ast_vector_dec_ref(c, v)
+	n := C.Z3_ast_vector_size(c, v)
+	for i := C.uint(0); i < n; i++ {
+		asserts = append(asserts, newAST(c, C.Z3_ast_vector_get(c, v, i)))
+	}
+	return
+}
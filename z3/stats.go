@@ -0,0 +1,40 @@
+//go:build cgo
+
+// ソルバーの統計情報
+// go-z3 は Z3_solver_get_statistics を提供していないため、ここで補う。
+
+package z3
+
+// #include <z3.h>
+//
+// /* Z3_bool は Z3 の版によって int もしくは bool となるため int で受け取る */
+// static int stats_is_uint(Z3_context c, Z3_stats s, unsigned i) {
+//     return Z3_stats_is_uint(c, s, i) ? 1 : 0;
+// }
+import "C"
+
+// Statistics はソルバーの最後の Check の統計情報 (conflicts、decisions、
+// propagations、memory など) を返す。
+func Statistics(ctx *Context, s *Solver) (stats map[string]float64) {
+	c := contextHandle(ctx)
+	stats = statsMap(c, C.Z3_solver_get_statistics(c, solverHandle(s)))
+	return
+}
+
+// statsMap は Z3 の統計情報を名前と値の map に変換する。
+func statsMap(c C.Z3_context, st C.Z3_stats) (stats map[string]float64) {
+	C.Z3_stats_inc_ref(c, st)
+	defer C.Z3_stats_dec_ref(c, st)
+
+	stats = map[string]float64{}
+	n := C.Z3_stats_size(c, st)
+	for i := C.uint(0); i < n; i++ {
+		key := C.GoString(C.Z3_stats_get_key(c, st, i))
+		if C.stats_is_uint(c, st, i) != 0 {
+			stats[key] = float64(C.Z3_stats_get_uint_value(c, st, i))
+		} else {
+			stats[key] = float64(C.Z3_stats_get_double_value(c, st, i))
+		}
+	}
+	return
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+
+// ロジックとタクティクを指定したソルバー
+// go-z3 は Z3_mk_solver のソルバーのみを提供しているため、
+// Z3_mk_solver_for_logic と Z3_mk_solver_from_tactic をここで補う。
+//
+// Z3 の既定のエラーハンドラーは不正な名前でプロセスを終了させるため、
+// 名前はあらかじめ CheckLogic と CheckTactics でチェックしておくこと。
+
+package z3
+
+// #include <stdlib.h>
+// #include <z3.h>
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// newSolver は Z3_solver から go-z3 の Solver を作成する。
+// go-z3 の Solver の Close で参照カウントを減らすため、ここで増やしておく。
+func newSolver(ctx C.Z3_context, s C.Z3_solver) *Solver {
+	C.Z3_solver_inc_ref(ctx, s)
+	return (*Solver)(unsafe.Pointer(&rawSolver{rawCtx: ctx, rawSolver: s}))
+}
+
+// NewSolverForLogic はロジック (QF_LIA など) を指定したソルバーを作成する。
+func NewSolverForLogic(ctx *Context, logic string) *Solver {
+	c := contextHandle(ctx)
+	return newSolver(c, C.Z3_mk_solver_for_logic(c, symbol(c, logic)))
+}
+
+// CheckLogic はロジックの名前が Z3 で使用できるかどうかをチェックする。
+// エラーハンドラーを外した作業用のコンテクストでソルバーを作成してみる。
+func CheckLogic(logic string) (err error) {
+	config := NewConfig()
+	ctx := NewContext(config)
+	config.Close()
+	defer ctx.Close()
+
+	c := contextHandle(ctx)
+	C.Z3_set_error_handler(c, nil)
+	s := C.Z3_mk_solver_for_logic(c, symbol(c, logic))
+	if C.Z3_get_error_code(c) != C.Z3_OK || s == nil {
+		err = fmt.Errorf("%s is unknown logic", logic)
+		return
+	}
+	C.Z3_solver_inc_ref(c, s)
+	C.Z3_solver_dec_ref(c, s)
+	return
+}
+
+// Tactics は Z3 で使用できるタクティクの名前のリストを返す。
+func Tactics() (names []string) {
+	config := NewConfig()
+	ctx := NewContext(config)
+	config.Close()
+	defer ctx.Close()
+
+	c := contextHandle(ctx)
+	n := C.Z3_get_num_tactics(c)
+	for i := C.uint(0); i < n; i++ {
+		names = append(names, C.GoString(C.Z3_get_tactic_name(c, i)))
+	}
+	return
+}
+
+// CheckTactics はタクティクの名前がすべて Z3 で使用できるかどうかをチェックする。
+func CheckTactics(names []string) (err error) {
+	known := map[string]bool{}
+	for _, name := range Tactics() {
+		known[name] = true
+	}
+	if len(names) == 0 {
+		err = fmt.Errorf("tactic is empty")
+		return
+	}
+	for _, name := range names {
+		if !known[name] {
+			err = fmt.Errorf("%s is unknown tactic", name)
+			return
+		}
+	}
+	return
+}
+
+// NewSolverFromTactics はタクティクを順に適用 (and-then) するソルバーを作成する。
+func NewSolverFromTactics(ctx *Context, names []string) *Solver {
+	c := contextHandle(ctx)
+	var t C.Z3_tactic
+	for i, name := range names {
+		cs := C.CString(name)
+		next := C.Z3_mk_tactic(c, cs)
+		C.free(unsafe.Pointer(cs))
+		C.Z3_tactic_inc_ref(c, next)
+		if i == 0 {
+			t = next
+			continue
+		}
+		seq := C.Z3_tactic_and_then(c, t, next)
+		C.Z3_tactic_inc_ref(c, seq)
+		C.Z3_tactic_dec_ref(c, t)
+		C.Z3_tactic_dec_ref(c, next)
+		t = seq
+	}
+	s := newSolver(c, C.Z3_mk_solver_from_tactic(c, t))
+	C.Z3_tactic_dec_ref(c, t)
+	return s
+}
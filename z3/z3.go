@@ -0,0 +1,80 @@
+//go:build cgo
+
+// go-z3 を使用するバックエンド (cgo が有効な場合)
+
+package z3
+
+// #cgo CFLAGS: -I${SRCDIR}/../../../mitchellh/go-z3/vendor/z3/src/api
+// #include <z3.h>
+import "C"
+
+import (
+	"unsafe"
+
+	goz3 "github.com/mitchellh/go-z3"
+)
+
+// go-z3 の型
+type (
+	Config  = goz3.Config
+	Context = goz3.Context
+	Symbol  = goz3.Symbol
+	Sort    = goz3.Sort
+	AST     = goz3.AST
+	Solver  = goz3.Solver
+	Model   = goz3.Model
+	LBool   = goz3.LBool
+)
+
+// 解決結果
+const (
+	False = goz3.False
+	Undef = goz3.Undef
+	True  = goz3.True
+)
+
+// NewConfig はコンテクストの設定を作成する。
+func NewConfig() *Config {
+	return goz3.NewConfig()
+}
+
+// NewContext はコンテクストを作成する。
+func NewContext(config *Config) *Context {
+	return goz3.NewContext(config)
+}
+
+// go-z3 の構造体と同じ配置の構造体
+type (
+	rawContext struct {
+		raw C.Z3_context
+	}
+	rawAST struct {
+		rawCtx C.Z3_context
+		rawAST C.Z3_ast
+	}
+)
+
+// contextHandle はコンテクストの Z3_context を返す。
+func contextHandle(ctx *Context) C.Z3_context {
+	return (*rawContext)(unsafe.Pointer(ctx)).raw
+}
+
+// astHandle は AST の Z3_ast を返す。
+func astHandle(x *AST) C.Z3_ast {
+	return (*rawAST)(unsafe.Pointer(x)).rawAST
+}
+
+// newAST は Z3_ast から go-z3 の AST を作成する。
+// 参照カウントを使用するコンテクストの場合に備えて参照カウントを増やしておく。
+func newAST(ctx C.Z3_context, x C.Z3_ast) *AST {
+	C.Z3_inc_ref(ctx, x)
+	return (*AST)(unsafe.Pointer(&rawAST{rawCtx: ctx, rawAST: x}))
+}
+
+// astHandles は AST のリストを Z3_ast の配列に変換する。
+func astHandles(xs []*AST) (handles []C.Z3_ast) {
+	for _, x := range xs {
+		handles = append(handles, astHandle(x))
+	}
+	return
+}